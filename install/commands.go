@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+)
+
+// command is a maintenance task that runs against an existing install
+// instead of the interactive installation flow.
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{
+		name:        "crowdsec",
+		usage:       "crowdsec <disable|enable|remove>",
+		description: "Take CrowdSec out of the request path, put it back, or remove it from the install",
+		run:         crowdsecCommand,
+	},
+	{
+		name:        "diff",
+		usage:       "diff",
+		description: "Compare the install with the installer's templates to find local changes and missing new defaults",
+		run:         diffCommand,
+	},
+	{
+		name:        "edition",
+		usage:       "edition <ee|oss>",
+		description: "Switch an existing install between the Enterprise and open source images",
+		run:         switchEdition,
+	},
+	{
+		name:        "reconfigure",
+		usage:       "reconfigure [flags]",
+		description: "Change the dashboard domain or a base domain of an existing install",
+		run:         reconfigureDomains,
+	},
+	{
+		name:        "rotate",
+		usage:       "rotate <all|credential>...",
+		description: "Rotate installer-managed credentials and restart the affected services",
+		run:         rotateCredentials,
+	},
+	{
+		name:        "update",
+		usage:       "update geoip",
+		description: "Download the latest GeoLite2 databases and restart Pangolin (used by the scheduled update)",
+		run:         updateCommand,
+	},
+}
+
+// runCommand runs the named command with the remaining arguments.
+func runCommand(name string, args []string) error {
+	if name == "help" {
+		printCommands()
+		return nil
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			// Commands that render templates use the ones the install was
+			// written with
+			if err := loadTemplateOverrides(); err != nil {
+				return err
+			}
+			return c.run(args)
+		}
+	}
+
+	printCommands()
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func printCommands() {
+	fmt.Println("Usage: installer [flags]")
+	fmt.Println("       installer <command> [arguments]")
+	fmt.Println("\nRunning the installer without a command starts the interactive installation.")
+	fmt.Println("\nCommands:")
+	for _, c := range commands {
+		fmt.Printf("  %-30s %s\n", c.usage, c.description)
+	}
+	fmt.Println("\nRun 'installer -h' to list the installation flags.")
+}
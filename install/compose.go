@@ -0,0 +1,488 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Compose is the part of a Docker Compose file the installer reads. Fields
+// accepting several syntaxes decode into a single normalized form.
+type Compose struct {
+	Name     string                    `yaml:"name"`
+	Services map[string]ComposeService `yaml:"services"`
+	Networks map[string]ComposeNetwork `yaml:"networks"`
+	Secrets  map[string]ComposeSecret  `yaml:"secrets"`
+}
+
+type ComposeService struct {
+	Image         string                 `yaml:"image"`
+	ContainerName string                 `yaml:"container_name"`
+	Restart       string                 `yaml:"restart"`
+	Environment   ComposeEnvironment     `yaml:"environment"`
+	EnvFile       ComposeStringList      `yaml:"env_file"`
+	Volumes       []ComposeVolume        `yaml:"volumes"`
+	DependsOn     ComposeDependsOn       `yaml:"depends_on"`
+	Networks      ComposeServiceNetworks `yaml:"networks"`
+	NetworkMode   string                 `yaml:"network_mode"`
+	Healthcheck   *ComposeHealthcheck    `yaml:"healthcheck"`
+	Secrets       []ComposeServiceSecret `yaml:"secrets"`
+}
+
+// ComposeVolume is a mount in either the short "source:target:mode" or the
+// long mapping syntax.
+type ComposeVolume struct {
+	Type     string `yaml:"type"`
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only"`
+}
+
+// ComposeServiceSecret is a secret granted to a service, by name or in the
+// long mapping syntax.
+type ComposeServiceSecret struct {
+	Source string `yaml:"source"`
+	Target string `yaml:"target"`
+}
+
+// ComposeDependency is one entry of depends_on. The list form decodes to the
+// service_started condition, which is what Compose assumes for it.
+type ComposeDependency struct {
+	Condition string `yaml:"condition"`
+	Restart   bool   `yaml:"restart"`
+}
+
+type ComposeDependsOn map[string]ComposeDependency
+
+// ComposeServiceNetworks holds the networks of a service in either the list
+// or the map form.
+type ComposeServiceNetworks map[string]ComposeServiceNetwork
+
+type ComposeServiceNetwork struct {
+	Aliases     []string `yaml:"aliases"`
+	IPv4Address string   `yaml:"ipv4_address"`
+	IPv6Address string   `yaml:"ipv6_address"`
+}
+
+// ComposeNetwork is a top-level network. The legacy external: {name: ...}
+// form decodes to External with the name of the network.
+type ComposeNetwork struct {
+	Name       string `yaml:"name"`
+	Driver     string `yaml:"driver"`
+	External   bool   `yaml:"external"`
+	EnableIPv6 bool   `yaml:"enable_ipv6"`
+}
+
+type ComposeSecret struct {
+	File        string `yaml:"file"`
+	Environment string `yaml:"environment"`
+}
+
+// ComposeHealthcheck is a service healthcheck. A test given as a string is
+// normalized to its CMD-SHELL list form.
+type ComposeHealthcheck struct {
+	Test        ComposeStringList `yaml:"test"`
+	Interval    string            `yaml:"interval"`
+	Timeout     string            `yaml:"timeout"`
+	Retries     int               `yaml:"retries"`
+	StartPeriod string            `yaml:"start_period"`
+	Disable     bool              `yaml:"disable"`
+}
+
+// ComposeEnvironment holds environment variables given as a map or as a
+// list of KEY=VALUE strings.
+type ComposeEnvironment map[string]string
+
+// ComposeStringList is a value that may be a single string or a list.
+type ComposeStringList []string
+
+func (v *ComposeVolume) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*v = parseShortVolume(node.Value)
+		return nil
+	}
+
+	type plain ComposeVolume
+	return node.Decode((*plain)(v))
+}
+
+// parseShortVolume parses "target", "source:target" or
+// "source:target:mode".
+func parseShortVolume(spec string) ComposeVolume {
+	parts := strings.Split(spec, ":")
+	if len(parts) == 1 {
+		return ComposeVolume{Type: "volume", Target: parts[0]}
+	}
+
+	v := ComposeVolume{Type: "volume", Source: parts[0], Target: parts[1]}
+	if strings.HasPrefix(v.Source, ".") || strings.HasPrefix(v.Source, "/") || strings.HasPrefix(v.Source, "~") {
+		v.Type = "bind"
+	}
+	if len(parts) > 2 {
+		for _, mode := range strings.Split(parts[2], ",") {
+			if mode == "ro" {
+				v.ReadOnly = true
+			}
+		}
+	}
+	return v
+}
+
+// String returns the volume in short syntax.
+func (v ComposeVolume) String() string {
+	s := v.Target
+	if v.Source != "" {
+		s = v.Source + ":" + v.Target
+	}
+	if v.ReadOnly {
+		s += ":ro"
+	}
+	return s
+}
+
+func (s *ComposeServiceSecret) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = ComposeServiceSecret{Source: node.Value}
+		return nil
+	}
+
+	type plain ComposeServiceSecret
+	return node.Decode((*plain)(s))
+}
+
+func (d *ComposeDependsOn) UnmarshalYAML(node *yaml.Node) error {
+	*d = make(ComposeDependsOn)
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			(*d)[item.Value] = ComposeDependency{Condition: "service_started"}
+		}
+		return nil
+	}
+
+	return node.Decode((*map[string]ComposeDependency)(d))
+}
+
+func (n *ComposeServiceNetworks) UnmarshalYAML(node *yaml.Node) error {
+	*n = make(ComposeServiceNetworks)
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			(*n)[item.Value] = ComposeServiceNetwork{}
+		}
+		return nil
+	}
+
+	return node.Decode((*map[string]ComposeServiceNetwork)(n))
+}
+
+func (n *ComposeNetwork) UnmarshalYAML(node *yaml.Node) error {
+	type plain ComposeNetwork
+	external := yamlMappingValue(node, "external")
+	if external == nil || external.Kind != yaml.MappingNode {
+		return node.Decode((*plain)(n))
+	}
+
+	stripped := *node
+	stripped.Content = slices.Clone(node.Content)
+	deleteYAMLMappingKey(&stripped, "external")
+	if err := stripped.Decode((*plain)(n)); err != nil {
+		return err
+	}
+	n.External = true
+	if name := yamlMappingValue(external, "name"); name != nil && n.Name == "" {
+		n.Name = name.Value
+	}
+	return nil
+}
+
+func (e *ComposeEnvironment) UnmarshalYAML(node *yaml.Node) error {
+	*e = make(ComposeEnvironment)
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			key, value, _ := strings.Cut(item.Value, "=")
+			(*e)[key] = value
+		}
+		return nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("environment must be a list or a map")
+	}
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		value := node.Content[i+1]
+		if value.Tag == "!!null" {
+			(*e)[node.Content[i].Value] = ""
+			continue
+		}
+		(*e)[node.Content[i].Value] = value.Value
+	}
+	return nil
+}
+
+func (l *ComposeStringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = ComposeStringList{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(l))
+}
+
+func (h *ComposeHealthcheck) UnmarshalYAML(node *yaml.Node) error {
+	type plain ComposeHealthcheck
+	if err := node.Decode((*plain)(h)); err != nil {
+		return err
+	}
+	if test := yamlMappingValue(node, "test"); test != nil && test.Kind == yaml.ScalarNode {
+		h.Test = ComposeStringList{"CMD-SHELL", test.Value}
+	}
+	return nil
+}
+
+// HasVolume reports whether the service mounts source at target.
+func (s ComposeService) HasVolume(source, target string) bool {
+	for _, v := range s.Volumes {
+		if v.Target == target && strings.TrimPrefix(v.Source, "./") == strings.TrimPrefix(source, "./") {
+			return true
+		}
+	}
+	return false
+}
+
+// composeFile is a compose file opened for editing. Reads go through the
+// typed Compose model, edits are applied to the YAML node tree so comments
+// and formatting survive, and the model is refreshed after every edit.
+type composeFile struct {
+	Compose
+
+	path     string
+	doc      *yaml.Node
+	original []byte
+}
+
+func loadComposeFile(path string) (*composeFile, error) {
+	doc, content, err := readYAMLFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cf := &composeFile{path: path, doc: doc, original: content}
+	if err := cf.refresh(); err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+func (cf *composeFile) refresh() error {
+	cf.Compose = Compose{}
+	if err := cf.doc.Decode(&cf.Compose); err != nil {
+		return fmt.Errorf("error parsing %s: %w", cf.path, err)
+	}
+	return nil
+}
+
+// save writes the edited file back.
+func (cf *composeFile) save() error {
+	return writeYAMLFile(cf.path, cf.doc, cf.original)
+}
+
+// HasService reports whether the compose file defines a service.
+func (cf *composeFile) HasService(name string) bool {
+	_, ok := cf.Services[name]
+	return ok
+}
+
+// serviceNames returns the names of the services in the order of the file.
+func (cf *composeFile) serviceNames() []string {
+	var names []string
+	services := yamlChildValue(cf.doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return names
+	}
+	for i := 0; i < len(services.Content)-1; i += 2 {
+		names = append(names, services.Content[i].Value)
+	}
+	return names
+}
+
+// serviceNode returns the mapping node of a service.
+func (cf *composeFile) serviceNode(name string) (*yaml.Node, error) {
+	services := yamlChildValue(cf.doc.Content[0], "services")
+	service := yamlChildValue(services, name)
+	if service == nil || service.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s service not found or invalid", name)
+	}
+	return service, nil
+}
+
+// setService adds a service definition, replacing an existing one.
+func (cf *composeFile) setService(name string, service *yaml.Node) error {
+	services, err := yamlChildMapping(cf.doc.Content[0], "services")
+	if err != nil {
+		return fmt.Errorf("services section has invalid format")
+	}
+	setYAMLMappingValue(services, name, service)
+	return cf.refresh()
+}
+
+// addVolume mounts a volume into a service unless the same source is already
+// mounted at the target. It reports whether the volume was added.
+func (cf *composeFile) addVolume(service string, volume ComposeVolume) (bool, error) {
+	if cf.Services[service].HasVolume(volume.Source, volume.Target) {
+		return false, nil
+	}
+
+	node, err := cf.serviceNode(service)
+	if err != nil {
+		return false, err
+	}
+	volumes := yamlChildValue(node, "volumes")
+	if volumes == nil {
+		volumes = &yaml.Node{Kind: yaml.SequenceNode}
+		setYAMLMappingValue(node, "volumes", volumes)
+	}
+	if volumes.Kind != yaml.SequenceNode {
+		return false, fmt.Errorf("%s volumes are not a list", service)
+	}
+
+	volumes.Content = append(volumes.Content, yamlScalar(volume.String()))
+	return true, cf.refresh()
+}
+
+// removeVolume unmounts source from target in a service, in short or long
+// syntax. It reports whether a volume was removed.
+func (cf *composeFile) removeVolume(service string, volume ComposeVolume) (bool, error) {
+	if !cf.Services[service].HasVolume(volume.Source, volume.Target) {
+		return false, nil
+	}
+
+	node, err := cf.serviceNode(service)
+	if err != nil {
+		return false, err
+	}
+	volumes := yamlChildValue(node, "volumes")
+	volumes.Content = slices.DeleteFunc(volumes.Content, func(n *yaml.Node) bool {
+		var v ComposeVolume
+		return n.Decode(&v) == nil && ComposeService{Volumes: []ComposeVolume{v}}.HasVolume(volume.Source, volume.Target)
+	})
+	if len(volumes.Content) == 0 {
+		deleteYAMLMappingKey(node, "volumes")
+	}
+	return true, cf.refresh()
+}
+
+// addDependency makes service depend on another one with a condition. A
+// depends_on list is converted to the map form, which can carry conditions.
+func (cf *composeFile) addDependency(service, dependency, condition string) error {
+	node, err := cf.serviceNode(service)
+	if err != nil {
+		return err
+	}
+
+	if dependsOn := yamlChildValue(node, "depends_on"); dependsOn != nil && dependsOn.Kind == yaml.SequenceNode {
+		converted := &yaml.Node{Kind: yaml.MappingNode}
+		for _, name := range dependsOn.Content {
+			setYAMLMappingValue(converted, name.Value, composeDependencyNode(cf.Services[service].DependsOn[name.Value].Condition))
+		}
+		setYAMLMappingValue(node, "depends_on", converted)
+	}
+
+	dependsOn, err := yamlChildMapping(node, "depends_on")
+	if err != nil {
+		return fmt.Errorf("%s depends_on has invalid format", service)
+	}
+	setYAMLMappingValue(dependsOn, dependency, composeDependencyNode(condition))
+	return cf.refresh()
+}
+
+// removeService deletes a service definition along with the dependencies
+// of the other services on it.
+func (cf *composeFile) removeService(name string) error {
+	services := yamlChildValue(cf.doc.Content[0], "services")
+	if !deleteYAMLMappingKey(services, name) {
+		return fmt.Errorf("%s service not found", name)
+	}
+
+	for i := 0; i < len(services.Content)-1; i += 2 {
+		service := services.Content[i+1]
+		dependsOn := yamlChildValue(service, "depends_on")
+		switch {
+		case dependsOn == nil:
+			continue
+		case dependsOn.Kind == yaml.MappingNode:
+			deleteYAMLMappingKey(dependsOn, name)
+		case dependsOn.Kind == yaml.SequenceNode:
+			dependsOn.Content = slices.DeleteFunc(dependsOn.Content, func(n *yaml.Node) bool { return n.Value == name })
+		}
+		if len(dependsOn.Content) == 0 {
+			deleteYAMLMappingKey(service, "depends_on")
+		}
+	}
+	return cf.refresh()
+}
+
+func composeDependencyNode(condition string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	setYAMLMappingValue(node, "condition", yamlScalar(condition))
+	return node
+}
+
+// setImage changes the image of a service, keeping the quoting of the old
+// value.
+func (cf *composeFile) setImage(service, image string) error {
+	node, err := cf.serviceNode(service)
+	if err != nil {
+		return err
+	}
+	current := yamlChildValue(node, "image")
+	if current == nil || current.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%s service has no image", service)
+	}
+	current.Value = image
+	return cf.refresh()
+}
+
+// setEnvironment sets a variable in the environment of a service, in
+// whichever form the service already uses.
+func (cf *composeFile) setEnvironment(service, key, value string) error {
+	node, err := cf.serviceNode(service)
+	if err != nil {
+		return err
+	}
+
+	env := yamlChildValue(node, "environment")
+	if env != nil && env.Kind == yaml.SequenceNode {
+		for _, item := range env.Content {
+			if k, _, _ := strings.Cut(item.Value, "="); k == key {
+				item.Value = key + "=" + value
+				return cf.refresh()
+			}
+		}
+		env.Content = append(env.Content, yamlScalar(key+"="+value))
+		return cf.refresh()
+	}
+
+	env, err = yamlChildMapping(node, "environment")
+	if err != nil {
+		return fmt.Errorf("%s environment has invalid format", service)
+	}
+	if existing := yamlMappingValue(env, key); existing != nil && existing.Kind == yaml.ScalarNode {
+		existing.Value = value
+		existing.Tag = "!!str"
+		return cf.refresh()
+	}
+	setYAMLMappingValue(env, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: yaml.DoubleQuotedStyle})
+	return cf.refresh()
+}
+
+// setComposeEnvironment sets a variable of a service in a compose file.
+func setComposeEnvironment(composePath, service, key, value string) error {
+	compose, err := loadComposeFile(composePath)
+	if err != nil {
+		return err
+	}
+	if err := compose.setEnvironment(service, key, value); err != nil {
+		return err
+	}
+	return compose.save()
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestComposeDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		compose string
+		want    Compose
+	}{
+		{
+			name: "short secrets",
+			compose: `services:
+  pangolin:
+    secrets:
+      - server_secret
+secrets:
+  server_secret:
+    file: ./config/secrets/server_secret
+`,
+			want: Compose{
+				Services: map[string]ComposeService{
+					"pangolin": {Secrets: []ComposeServiceSecret{{Source: "server_secret"}}},
+				},
+				Secrets: map[string]ComposeSecret{
+					"server_secret": {File: "./config/secrets/server_secret"},
+				},
+			},
+		},
+		{
+			name: "long secrets",
+			compose: `services:
+  pangolin:
+    secrets:
+      - source: server_secret
+        target: /run/secrets/secret
+      - redis_password
+secrets:
+  server_secret:
+    environment: SERVER_SECRET
+`,
+			want: Compose{
+				Services: map[string]ComposeService{
+					"pangolin": {Secrets: []ComposeServiceSecret{
+						{Source: "server_secret", Target: "/run/secrets/secret"},
+						{Source: "redis_password"},
+					}},
+				},
+				Secrets: map[string]ComposeSecret{
+					"server_secret": {Environment: "SERVER_SECRET"},
+				},
+			},
+		},
+		{
+			name: "external network",
+			compose: `networks:
+  default:
+    name: pangolin
+    external: true
+`,
+			want: Compose{
+				Networks: map[string]ComposeNetwork{
+					"default": {Name: "pangolin", External: true},
+				},
+			},
+		},
+		{
+			name: "external network by legacy name",
+			compose: `networks:
+  default:
+    external:
+      name: pangolin
+`,
+			want: Compose{
+				Networks: map[string]ComposeNetwork{
+					"default": {Name: "pangolin", External: true},
+				},
+			},
+		},
+		{
+			name: "external network name takes precedence",
+			compose: `networks:
+  default:
+    name: proxy
+    external:
+      name: pangolin
+`,
+			want: Compose{
+				Networks: map[string]ComposeNetwork{
+					"default": {Name: "proxy", External: true},
+				},
+			},
+		},
+		{
+			name: "service networks list",
+			compose: `services:
+  traefik:
+    networks:
+      - default
+      - proxy
+networks:
+  proxy:
+    external: true
+`,
+			want: Compose{
+				Services: map[string]ComposeService{
+					"traefik": {Networks: ComposeServiceNetworks{"default": {}, "proxy": {}}},
+				},
+				Networks: map[string]ComposeNetwork{
+					"proxy": {External: true},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Compose
+			if err := yaml.Unmarshal([]byte(tt.compose), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"reflect"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -44,23 +46,109 @@ type TraefikConfigValues struct {
 	BadgerVersion    string
 }
 
-// AppConfig represents the app section of the config.yml
+// AppConfig represents the sections of the config.yml read by the installer
 type AppConfig struct {
 	App struct {
 		DashboardURL string `yaml:"dashboard_url"`
 		LogLevel     string `yaml:"log_level"`
 	} `yaml:"app"`
+	Domains map[string]struct {
+		BaseDomain         string `yaml:"base_domain"`
+		CertResolver       string `yaml:"cert_resolver"`
+		PreferWildcardCert *bool  `yaml:"prefer_wildcard_cert"`
+	} `yaml:"domains"`
+	Server struct {
+		Secret         string `yaml:"secret"`
+		MaxMindDBPath  string `yaml:"maxmind_db_path"`
+		MaxMindASNPath string `yaml:"maxmind_asn_path"`
+	} `yaml:"server"`
+	Email struct {
+		SMTPHost                  string `yaml:"smtp_host"`
+		SMTPPort                  int    `yaml:"smtp_port"`
+		SMTPUser                  string `yaml:"smtp_user"`
+		SMTPPass                  string `yaml:"smtp_pass"`
+		SMTPSecure                bool   `yaml:"smtp_secure"`
+		SMTPTLSRejectUnauthorized bool   `yaml:"smtp_tls_reject_unauthorized"`
+		NoReply                   string `yaml:"no_reply"`
+	} `yaml:"email"`
 }
 
 type AppConfigValues struct {
-	DashboardURL string
-	LogLevel     string
+	DashboardURL              string
+	LogLevel                  string
+	BaseDomains               []BaseDomain
+	Secret                    string
+	MaxMindDBPath             string
+	MaxMindASNPath            string
+	SMTPHost                  string
+	SMTPPort                  int
+	SMTPUser                  string
+	SMTPPass                  string
+	SMTPSecure                bool
+	SMTPTLSRejectUnauthorized bool
+	NoReply                   string
+}
+
+// PrivateConfig represents the sections of the privateConfig.yml read by the installer
+type PrivateConfig struct {
+	Redis struct {
+		Host     string `yaml:"host"`
+		Port     int    `yaml:"port"`
+		Password string `yaml:"password"`
+		DB       int    `yaml:"db"`
+		Replicas []struct {
+			Host string `yaml:"host"`
+			Port int    `yaml:"port"`
+		} `yaml:"replicas"`
+	} `yaml:"redis"`
+	Flags struct {
+		EnableRedis bool `yaml:"enable_redis"`
+	} `yaml:"flags"`
+	Branding struct {
+		AppName string `yaml:"app_name"`
+		Colors  struct {
+			Light struct {
+				Primary string `yaml:"primary"`
+			} `yaml:"light"`
+			Dark struct {
+				Primary string `yaml:"primary"`
+			} `yaml:"dark"`
+		} `yaml:"colors"`
+		Logo struct {
+			LightPath string `yaml:"light_path"`
+			DarkPath  string `yaml:"dark_path"`
+		} `yaml:"logo"`
+	} `yaml:"branding"`
+}
+
+// CrowdsecPluginConfig is the part of the CrowdSec plugin middleware the
+// installer manages
+type CrowdsecPluginConfig struct {
+	LapiKey                    string   `yaml:"crowdsecLapiKey"`
+	ForwardedHeadersTrustedIPs []string `yaml:"forwardedHeadersTrustedIPs"`
+	ClientTrustedIPs           []string `yaml:"clientTrustedIPs"`
+	CaptchaProvider            string   `yaml:"captchaProvider"`
+	CaptchaSiteKey             string   `yaml:"captchaSiteKey"`
+	CaptchaSecretKey           string   `yaml:"captchaSecretKey"`
+}
+
+// CrowdsecDynamicConfig represents the CrowdSec plugin middleware in the dynamic configuration
+type CrowdsecDynamicConfig struct {
+	HTTP struct {
+		Middlewares struct {
+			Crowdsec struct {
+				Plugin struct {
+					Crowdsec CrowdsecPluginConfig `yaml:"crowdsec"`
+				} `yaml:"plugin"`
+			} `yaml:"crowdsec"`
+		} `yaml:"middlewares"`
+	} `yaml:"http"`
 }
 
 // ReadTraefikConfig reads and extracts values from Traefik configuration files
 func ReadTraefikConfig(mainConfigPath string) (*TraefikConfigValues, error) {
 	// Read main config file
-	mainConfigData, err := os.ReadFile(mainConfigPath)
+	mainConfigData, err := readFile(mainConfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("error reading main config file: %w", err)
 	}
@@ -81,7 +169,7 @@ func ReadTraefikConfig(mainConfigPath string) (*TraefikConfigValues, error) {
 
 func ReadAppConfig(configPath string) (*AppConfigValues, error) {
 	// Read config file
-	configData, err := os.ReadFile(configPath)
+	configData, err := readFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
@@ -92,92 +180,115 @@ func ReadAppConfig(configPath string) (*AppConfigValues, error) {
 	}
 
 	values := &AppConfigValues{
-		DashboardURL: appConfig.App.DashboardURL,
-		LogLevel:     appConfig.App.LogLevel,
+		DashboardURL:              appConfig.App.DashboardURL,
+		LogLevel:                  appConfig.App.LogLevel,
+		Secret:                    appConfig.Server.Secret,
+		MaxMindDBPath:             appConfig.Server.MaxMindDBPath,
+		MaxMindASNPath:            appConfig.Server.MaxMindASNPath,
+		SMTPHost:                  appConfig.Email.SMTPHost,
+		SMTPPort:                  appConfig.Email.SMTPPort,
+		SMTPUser:                  appConfig.Email.SMTPUser,
+		SMTPPass:                  appConfig.Email.SMTPPass,
+		SMTPSecure:                appConfig.Email.SMTPSecure,
+		SMTPTLSRejectUnauthorized: appConfig.Email.SMTPTLSRejectUnauthorized,
+		NoReply:                   appConfig.Email.NoReply,
+	}
+
+	// Keep the order the installer writes them in: domain1, domain2, ..., domain10
+	names := make([]string, 0, len(appConfig.Domains))
+	for name := range appConfig.Domains {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) < len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		d := appConfig.Domains[name]
+		values.BaseDomains = append(values.BaseDomains, BaseDomain{
+			Name:               name,
+			Domain:             d.BaseDomain,
+			CertResolver:       d.CertResolver,
+			PreferWildcardCert: d.PreferWildcardCert,
+		})
 	}
 
 	return values, nil
 }
 
-// findPattern finds the start of a pattern in a string
-func findPattern(s, pattern string) int {
-	return bytes.Index([]byte(s), []byte(pattern))
-}
-
-func copyDockerService(sourceFile, destFile, serviceName string) error {
-	// Read source file
-	sourceData, err := os.ReadFile(sourceFile)
+// ReadPrivateConfig reads the Enterprise edition private configuration
+func ReadPrivateConfig(configPath string) (*PrivateConfig, error) {
+	configData, err := readFile(configPath)
 	if err != nil {
-		return fmt.Errorf("error reading source file: %w", err)
+		return nil, fmt.Errorf("error reading private config file: %w", err)
 	}
 
-	// Read destination file
-	destData, err := os.ReadFile(destFile)
-	if err != nil {
-		return fmt.Errorf("error reading destination file: %w", err)
+	var privateConfig PrivateConfig
+	if err := yaml.Unmarshal(configData, &privateConfig); err != nil {
+		return nil, fmt.Errorf("error parsing private config file: %w", err)
 	}
 
-	// Parse source Docker Compose YAML
-	var sourceCompose map[string]interface{}
-	if err := yaml.Unmarshal(sourceData, &sourceCompose); err != nil {
-		return fmt.Errorf("error parsing source Docker Compose file: %w", err)
-	}
+	return &privateConfig, nil
+}
 
-	// Parse destination Docker Compose YAML
-	var destCompose map[string]interface{}
-	if err := yaml.Unmarshal(destData, &destCompose); err != nil {
-		return fmt.Errorf("error parsing destination Docker Compose file: %w", err)
+// ReadBouncerKey reads the CrowdSec bouncer key from the dynamic configuration
+func ReadBouncerKey(dynamicConfigPath string) (string, error) {
+	configData, err := readFile(dynamicConfigPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading dynamic config file: %w", err)
 	}
 
-	// Get services section from source
-	sourceServices, ok := sourceCompose["services"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("services section not found in source file or has invalid format")
+	var dynamicConfig CrowdsecDynamicConfig
+	if err := yaml.Unmarshal(configData, &dynamicConfig); err != nil {
+		return "", fmt.Errorf("error parsing dynamic config file: %w", err)
 	}
 
-	// Get the specific service configuration
-	serviceConfig, ok := sourceServices[serviceName]
-	if !ok {
-		return fmt.Errorf("service '%s' not found in source file", serviceName)
-	}
+	return dynamicConfig.HTTP.Middlewares.Crowdsec.Plugin.Crowdsec.LapiKey, nil
+}
 
-	// Get or create services section in destination
-	destServices, ok := destCompose["services"].(map[string]interface{})
-	if !ok {
-		// If services section doesn't exist, create it
-		destServices = make(map[string]interface{})
-		destCompose["services"] = destServices
+// ReadCrowdsecTrustedIPs reads the trusted proxies and clients of the
+// CrowdSec plugin from the dynamic configuration
+func ReadCrowdsecTrustedIPs(dynamicConfigPath string) ([]string, []string, error) {
+	plugin, err := readCrowdsecPluginConfig(dynamicConfigPath)
+	if err != nil {
+		return nil, nil, err
 	}
+	return plugin.ForwardedHeadersTrustedIPs, plugin.ClientTrustedIPs, nil
+}
 
-	// Update service in destination
-	destServices[serviceName] = serviceConfig
-
-	// Marshal updated destination YAML
-	// Use yaml.v3 encoder to preserve formatting and comments
-	// updatedData, err := yaml.Marshal(destCompose)
-	updatedData, err := MarshalYAMLWithIndent(destCompose, 2)
+// readCrowdsecPluginConfig reads the settings of the CrowdSec plugin
+// middleware from the dynamic configuration
+func readCrowdsecPluginConfig(dynamicConfigPath string) (CrowdsecPluginConfig, error) {
+	configData, err := readFile(dynamicConfigPath)
 	if err != nil {
-		return fmt.Errorf("error marshaling updated Docker Compose file: %w", err)
+		return CrowdsecPluginConfig{}, fmt.Errorf("error reading dynamic config file: %w", err)
 	}
 
-	// Write updated YAML back to destination file
-	if err := os.WriteFile(destFile, updatedData, 0644); err != nil {
-		return fmt.Errorf("error writing to destination file: %w", err)
+	var dynamicConfig CrowdsecDynamicConfig
+	if err := yaml.Unmarshal(configData, &dynamicConfig); err != nil {
+		return CrowdsecPluginConfig{}, fmt.Errorf("error parsing dynamic config file: %w", err)
 	}
 
-	return nil
+	return dynamicConfig.HTTP.Middlewares.Crowdsec.Plugin.Crowdsec, nil
+}
+
+// findPattern finds the start of a pattern in a string
+func findPattern(s, pattern string) int {
+	return bytes.Index([]byte(s), []byte(pattern))
 }
 
 func backupConfig() error {
 	// Backup docker-compose.yml
-	if _, err := os.Stat("docker-compose.yml"); err == nil {
+	if fileExists("docker-compose.yml") {
 		if err := copyFile("docker-compose.yml", "docker-compose.yml.backup"); err != nil {
 			return fmt.Errorf("failed to backup docker-compose.yml: %v", err)
 		}
 	}
 
 	// Backup config directory
-	if _, err := os.Stat("config"); err == nil {
+	if _, err := os.Stat("config"); err == nil && !dryRunCommand("tar", "-czvf", "config.tar.gz", "config") {
 		cmd := exec.Command("tar", "-czvf", "config.tar.gz", "config")
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("failed to backup config directory: %v", err)
@@ -203,7 +314,7 @@ func MarshalYAMLWithIndent(data interface{}, indent int) ([]byte, error) {
 
 func replaceInFile(filepath, oldStr, newStr string) error {
 	// Read the file content
-	content, err := os.ReadFile(filepath)
+	content, err := readFile(filepath)
 	if err != nil {
 		return fmt.Errorf("error reading file: %v", err)
 	}
@@ -212,7 +323,7 @@ func replaceInFile(filepath, oldStr, newStr string) error {
 	newContent := strings.Replace(string(content), oldStr, newStr, -1)
 
 	// Write the modified content back to the file
-	err = os.WriteFile(filepath, []byte(newContent), 0644)
+	err = writeFile(filepath, []byte(newContent), 0644)
 	if err != nil {
 		return fmt.Errorf("error writing file: %v", err)
 	}
@@ -220,132 +331,122 @@ func replaceInFile(filepath, oldStr, newStr string) error {
 	return nil
 }
 
-func CheckAndAddTraefikLogVolume(composePath string) error {
-	// Read the docker-compose.yml file
-	data, err := os.ReadFile(composePath)
+// replaceYAMLValue replaces oldValue with newValue on the lines of a YAML
+// file that set key. Everything else, including comments, stays untouched.
+// It reports whether any line was changed.
+func replaceYAMLValue(filepath, key, oldValue, newValue string) (bool, error) {
+	content, err := readFile(filepath)
 	if err != nil {
-		return fmt.Errorf("error reading compose file: %w", err)
+		return false, fmt.Errorf("error reading file: %v", err)
 	}
 
-	// Parse YAML into a generic map
-	var compose map[string]interface{}
-	if err := yaml.Unmarshal(data, &compose); err != nil {
-		return fmt.Errorf("error parsing compose file: %w", err)
+	changed := false
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(strings.TrimSpace(line), "- ")
+		if !strings.HasPrefix(trimmed, key+":") {
+			continue
+		}
+		keyEnd := strings.Index(line, key+":") + len(key) + 1
+		if !strings.Contains(line[keyEnd:], oldValue) {
+			continue
+		}
+		lines[i] = line[:keyEnd] + strings.Replace(line[keyEnd:], oldValue, newValue, 1)
+		changed = true
 	}
 
-	// Get services section
-	services, ok := compose["services"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("services section not found or invalid")
+	if !changed {
+		return false, nil
 	}
 
-	// Get traefik service
-	traefik, ok := services["traefik"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("traefik service not found or invalid")
+	if err := writeFile(filepath, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		return false, fmt.Errorf("error writing file: %v", err)
 	}
 
-	// Check volumes
-	logVolume := "./config/traefik/logs:/var/log/traefik"
-	var volumes []interface{}
+	return true, nil
+}
 
-	if existingVolumes, ok := traefik["volumes"].([]interface{}); ok {
-		// Check if volume already exists
-		for _, v := range existingVolumes {
-			if v.(string) == logVolume {
-				fmt.Println("Traefik log volume is already configured")
-				return nil
-			}
-		}
-		volumes = existingVolumes
+// SetYAMLValue sets the scalar at keys in a YAML file, creating missing
+// mappings on the way. The file is edited as a node tree so comments and key
+// order survive, and the result is checked to differ from the original only
+// in that value before it replaces the file.
+func SetYAMLValue(path string, value string, keys ...string) error {
+	doc, content, err := readYAMLFile(path)
+	if err != nil {
+		return err
+	}
+	if err := setYAMLNodeValue(doc, value, keys...); err != nil {
+		return fmt.Errorf("error updating %s: %v", path, err)
 	}
 
-	// Add new volume
-	volumes = append(volumes, logVolume)
-	traefik["volumes"] = volumes
-
-	// Write updated config back to file
-	newData, err := MarshalYAMLWithIndent(compose, 2)
+	data, err := encodeYAML(doc, content)
 	if err != nil {
-		return fmt.Errorf("error marshaling updated compose file: %w", err)
+		return fmt.Errorf("error marshaling %s: %v", path, err)
 	}
 
-	if err := os.WriteFile(composePath, newData, 0644); err != nil {
-		return fmt.Errorf("error writing updated compose file: %w", err)
+	// Apply the same change to a plain decode of the original and compare it
+	// with the edited file, so nothing else can have changed by accident
+	var expected, actual map[string]interface{}
+	if err := yaml.Unmarshal(content, &expected); err != nil {
+		return fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	if expected == nil {
+		expected = make(map[string]interface{})
+	}
+	m := expected
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = value
+	if err := yaml.Unmarshal(data, &actual); err != nil {
+		return fmt.Errorf("edited %s is not valid YAML: %v", path, err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		return fmt.Errorf("edited %s does not match the expected result, leaving it unchanged", path)
 	}
 
-	fmt.Println("Added traefik log volume and created logs directory")
-	return nil
+	return writeFileInPlace(path, data)
 }
 
+// traefikLogsVolume mounts the directory of Traefik's access log, which
+// CrowdSec reads.
+var traefikLogsVolume = ComposeVolume{Type: "bind", Source: "./config/traefik/logs", Target: "/var/log/traefik"}
+
 // MergeYAML merges two YAML files, where the contents of the second file
 // are merged into the first file. In case of conflicts, values from the
-// second file take precedence.
+// second file take precedence. Lists are replaced unless the x-merge section
+// of the second file selects another strategy for them.
 func MergeYAML(baseFile, overlayFile string) error {
-	// Read the base YAML file
-	baseContent, err := os.ReadFile(baseFile)
+	base, baseContent, err := readYAMLFile(baseFile)
 	if err != nil {
 		return fmt.Errorf("error reading base file: %v", err)
 	}
 
-	// Read the overlay YAML file
-	overlayContent, err := os.ReadFile(overlayFile)
+	overlay, _, err := readYAMLFile(overlayFile)
 	if err != nil {
 		return fmt.Errorf("error reading overlay file: %v", err)
 	}
 
-	// Parse base YAML into a map
-	var baseMap map[string]interface{}
-	if err := yaml.Unmarshal(baseContent, &baseMap); err != nil {
-		return fmt.Errorf("error parsing base YAML: %v", err)
-	}
-
-	// Parse overlay YAML into a map
-	var overlayMap map[string]interface{}
-	if err := yaml.Unmarshal(overlayContent, &overlayMap); err != nil {
-		return fmt.Errorf("error parsing overlay YAML: %v", err)
+	// The overlay may choose how its lists are merged
+	rules, err := extractMergeRules(overlay.Content[0])
+	if err != nil {
+		return fmt.Errorf("error reading merge rules of %s: %v", overlayFile, err)
 	}
 
 	// Merge the overlay into the base
-	merged := mergeMap(baseMap, overlayMap)
-
-	// Marshal the merged result back to YAML
-	mergedContent, err := MarshalYAMLWithIndent(merged, 2)
-	if err != nil {
-		return fmt.Errorf("error marshaling merged YAML: %v", err)
+	if err := mergeYAMLNodes(base.Content[0], overlay.Content[0], rules, nil); err != nil {
+		return fmt.Errorf("error merging %s into %s: %v", overlayFile, baseFile, err)
 	}
 
 	// Write the merged content back to the base file
-	if err := os.WriteFile(baseFile, mergedContent, 0644); err != nil {
+	if err := writeYAMLFile(baseFile, base, baseContent); err != nil {
 		return fmt.Errorf("error writing merged YAML: %v", err)
 	}
 
 	return nil
 }
-
-// mergeMap recursively merges two maps
-func mergeMap(base, overlay map[string]interface{}) map[string]interface{} {
-	result := make(map[string]interface{})
-
-	// Copy all key-values from base map
-	for k, v := range base {
-		result[k] = v
-	}
-
-	// Merge overlay values
-	for k, v := range overlay {
-		// If both maps have the same key and both values are maps, merge recursively
-		if baseVal, ok := base[k]; ok {
-			if baseMap, isBaseMap := baseVal.(map[string]interface{}); isBaseMap {
-				if overlayMap, isOverlayMap := v.(map[string]interface{}); isOverlayMap {
-					result[k] = mergeMap(baseMap, overlayMap)
-					continue
-				}
-			}
-		}
-		// Otherwise, overlay value takes precedence
-		result[k] = v
-	}
-
-	return result
-}
@@ -13,6 +13,10 @@ import (
 )
 
 func waitForContainer(containerName string, containerType SupportedContainer) error {
+	if isDryRun() {
+		return nil
+	}
+
 	maxAttempts := 30
 	retryInterval := time.Second * 2
 
@@ -138,6 +142,12 @@ func installDocker() error {
 		return fmt.Errorf("unsupported Linux distribution")
 	}
 
+	// Print the script on one line in a dry run
+	script := strings.Join(strings.Fields(installCmd.Args[2]), " ")
+	if dryRunCommand("bash", "-c", script) {
+		return nil
+	}
+
 	installCmd.Stdout = os.Stdout
 	installCmd.Stderr = os.Stderr
 	return installCmd.Run()
@@ -145,6 +155,9 @@ func installDocker() error {
 
 func startDockerService() error {
 	if runtime.GOOS == "linux" {
+		if dryRunCommand("systemctl", "enable", "--now", "docker") {
+			return nil
+		}
 		cmd := exec.Command("systemctl", "enable", "--now", "docker")
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -212,37 +225,36 @@ func isDockerRunning() bool {
 
 // executeDockerComposeCommandWithArgs executes the appropriate docker command with arguments supplied
 func executeDockerComposeCommandWithArgs(args ...string) error {
-	var cmd *exec.Cmd
-	var useNewStyle bool
-
-	if !isDockerInstalled() {
-		return fmt.Errorf("docker is not installed")
-	}
-
-	checkCmd := exec.Command("docker", "compose", "version")
-	if err := checkCmd.Run(); err == nil {
-		useNewStyle = true
-	} else {
-		checkCmd = exec.Command("docker-compose", "version")
-		if err := checkCmd.Run(); err == nil {
-			useNewStyle = false
-		} else {
-			return fmt.Errorf("neither 'docker compose' nor 'docker-compose' command is available")
-		}
+	// Docker may only be installed later in a dry run
+	if dryRunCommand("docker", append([]string{"compose"}, args...)...) {
+		return nil
 	}
 
-	if useNewStyle {
-		cmd = exec.Command("docker", append([]string{"compose"}, args...)...)
-	} else {
-		cmd = exec.Command("docker-compose", args...)
+	cmd, err := dockerComposeCommand(args...)
+	if err != nil {
+		return err
 	}
-
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-// pullContainers pulls the containers using the appropriate command.
+// dockerComposeCommand builds a compose command, preferring the compose
+// plugin over the standalone docker-compose.
+func dockerComposeCommand(args ...string) (*exec.Cmd, error) {
+	if !isDockerInstalled() {
+		return nil, fmt.Errorf("docker is not installed")
+	}
+
+	if err := exec.Command("docker", "compose", "version").Run(); err == nil {
+		return exec.Command("docker", append([]string{"compose"}, args...)...), nil
+	}
+	if err := exec.Command("docker-compose", "version").Run(); err == nil {
+		return exec.Command("docker-compose", args...), nil
+	}
+	return nil, fmt.Errorf("neither 'docker compose' nor 'docker-compose' command is available")
+}
+
 func pullContainers(containerType SupportedContainer) error {
 	fmt.Println("Pulling the container images...")
 	if containerType == Podman {
@@ -254,6 +266,9 @@ func pullContainers(containerType SupportedContainer) error {
 	}
 
 	if containerType == Docker {
+		if showProgress() {
+			return pullContainersWithProgress()
+		}
 		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "pull", "--policy", "always"); err != nil {
 			return fmt.Errorf("failed to pull the containers: %v", err)
 		}
@@ -266,6 +281,10 @@ func pullContainers(containerType SupportedContainer) error {
 
 // startContainers starts the containers using the appropriate command.
 func startContainers(containerType SupportedContainer) error {
+	if err := validateInstallConfig(); err != nil {
+		return fmt.Errorf("refusing to start containers: %v", err)
+	}
+
 	fmt.Println("Starting containers...")
 
 	if containerType == Podman {
@@ -277,6 +296,9 @@ func startContainers(containerType SupportedContainer) error {
 	}
 
 	if containerType == Docker {
+		if showProgress() {
+			return startContainersWithProgress()
+		}
 		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "up", "-d", "--force-recreate"); err != nil {
 			return fmt.Errorf("failed to start containers: %v", err)
 		}
@@ -309,11 +331,19 @@ func stopContainers(containerType SupportedContainer) error {
 	return fmt.Errorf("Unsupported container type: %s", containerType)
 }
 
+// startService starts a single service of the compose file.
+func startService(service string, containerType SupportedContainer) error {
+	if containerType == Podman {
+		return run("podman-compose", "-f", "docker-compose.yml", "up", "-d", service)
+	}
+	return executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "up", "-d", service)
+}
+
 // restartContainer restarts a specific container using the appropriate command.
 func restartContainer(container string, containerType SupportedContainer) error {
 	fmt.Println("Restarting containers...")
 	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "restart"); err != nil {
+		if err := run("podman-compose", "-f", "docker-compose.yml", "restart", container); err != nil {
 			return fmt.Errorf("failed to stop the container \"%s\": %v", container, err)
 		}
 
@@ -330,3 +360,77 @@ func restartContainer(container string, containerType SupportedContainer) error
 
 	return fmt.Errorf("Unsupported container type: %s", containerType)
 }
+
+// detectContainerType picks the container runtime of an existing install,
+// preferring Docker when both are available.
+func detectContainerType() SupportedContainer {
+	if isDockerInstalled() {
+		return Docker
+	}
+	if isPodmanInstalled() {
+		return Podman
+	}
+	return Undefined
+}
+
+// recreateContainers recreates the given services so they pick up changes to
+// the compose file, env files and secrets. Other services are left running.
+func recreateContainers(containerType SupportedContainer, services ...string) error {
+	fmt.Printf("Recreating %s...\n", strings.Join(services, ", "))
+
+	args := append([]string{"-f", "docker-compose.yml", "up", "-d", "--force-recreate", "--no-deps"}, services...)
+
+	if containerType == Podman {
+		if err := run("podman-compose", args...); err != nil {
+			return fmt.Errorf("failed to recreate containers: %v", err)
+		}
+
+		return nil
+	}
+
+	if containerType == Docker {
+		if err := executeDockerComposeCommandWithArgs(args...); err != nil {
+			return fmt.Errorf("failed to recreate containers: %v", err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported container type: %s", containerType)
+}
+
+// waitForHealthy waits until a container reports healthy. Containers without
+// a healthcheck are considered healthy as soon as they are running.
+func waitForHealthy(containerName string, containerType SupportedContainer) error {
+	if isDryRun() {
+		return nil
+	}
+
+	maxAttempts := 60
+	retryInterval := time.Second * 2
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		cmd := exec.Command(string(containerType), "container", "inspect", "-f", "{{if .State.Health}}{{.State.Health.Status}}{{else}}{{.State.Status}}{{end}}", containerName)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+
+		if err := cmd.Run(); err == nil {
+			switch strings.TrimSpace(out.String()) {
+			case "healthy", "running":
+				return nil
+			case "exited", "dead":
+				return fmt.Errorf("container %s stopped", containerName)
+			}
+		}
+
+		time.Sleep(retryInterval)
+	}
+
+	return fmt.Errorf("container %s did not become healthy within %v seconds", containerName, maxAttempts*int(retryInterval.Seconds()))
+}
+
+// isContainerRunning reports whether the named container is running.
+func isContainerRunning(containerName string, containerType SupportedContainer) bool {
+	out, err := exec.Command(string(containerType), "container", "inspect", "-f", "{{.State.Running}}", containerName).Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
@@ -1,113 +1,130 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
-	"log"
-	"os"
 	"os/exec"
 	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
-func installCrowdsec(config Config) error {
+// bouncerKeyPlaceholder stands in for the bouncer key in the CrowdSec
+// dynamic config template until the bouncer is registered.
+const bouncerKeyPlaceholder = "PUT_YOUR_BOUNCER_KEY_HERE_OR_IT_WILL_NOT_WORK"
 
-	if err := stopContainers(config.InstallationContainerType); err != nil {
-		return fmt.Errorf("failed to stop containers: %v", err)
+// readCrowdsecChoice asks whether CrowdSec should be deployed.
+func readCrowdsecChoice(reader *bufio.Reader) bool {
+	if !readBool(reader, "Would you like to install CrowdSec?", false) {
+		return false
 	}
+	fmt.Println("This installer constitutes a minimal viable CrowdSec deployment. CrowdSec will add extra complexity to your Pangolin installation and may not work to the best of its abilities out of the box. Users are expected to implement configuration adjustments on their own to achieve the best security posture. Consult the CrowdSec documentation for detailed configuration instructions.")
+	return readBool(reader, "Are you willing to manage CrowdSec?", false)
+}
 
-	// Run installation steps
-	if err := backupConfig(); err != nil {
-		return fmt.Errorf("backup failed: %v", err)
-	}
+// mergeCrowdsecConfigFiles folds the freshly rendered CrowdSec templates
+// into the Traefik configs and the compose file at composePath, which is
+// still in the config directory for a new install.
+func mergeCrowdsecConfigFiles(composePath string, config Config) error {
+	mkdirAll("config/crowdsec/db", 0755)
+	mkdirAll("config/crowdsec/acquis.d", 0755)
+	mkdirAll("config/traefik/logs", 0755)
 
-	if err := createConfigFiles(config); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+	if err := applyCrowdsecTemplates(".", composePath, config); err != nil {
+		return fmt.Errorf("error adding CrowdSec to the config: %v", err)
 	}
 
-	os.MkdirAll("config/crowdsec/db", 0755)
-	os.MkdirAll("config/crowdsec/acquis.d", 0755)
-	os.MkdirAll("config/traefik/logs", 0755)
-
-	if err := copyDockerService("config/crowdsec/docker-compose.yml", "docker-compose.yml", "crowdsec"); err != nil {
-		fmt.Printf("Error copying docker service: %v\n", err)
-		os.Exit(1)
+	for _, name := range []string{"traefik_config.yml", "dynamic_config.yml", "docker-compose.yml"} {
+		if err := removeFile("config/crowdsec/" + name); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	if err := MergeYAML("config/traefik/traefik_config.yml", "config/crowdsec/traefik_config.yml"); err != nil {
-		fmt.Printf("Error copying entry points: %v\n", err)
-		os.Exit(1)
+// provisionCrowdsecBouncer starts CrowdSec on its own and registers the
+// Traefik bouncer, so Traefik starts with its key in place. A key that is
+// already in the config, e.g. from an interrupted install, is kept.
+func provisionCrowdsecBouncer(config Config) error {
+	if !checkIfTextInFile("config/traefik/dynamic_config.yml", bouncerKeyPlaceholder) {
+		return nil
 	}
-	// delete the 2nd file
-	if err := os.Remove("config/crowdsec/traefik_config.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+	containerType := config.InstallationContainerType
+
+	fmt.Println("Starting CrowdSec to register the Traefik bouncer...")
+	if err := startService("crowdsec", containerType); err != nil {
+		return fmt.Errorf("failed to start crowdsec: %v", err)
 	}
 
-	if err := MergeYAML("config/traefik/dynamic_config.yml", "config/crowdsec/dynamic_config.yml"); err != nil {
-		fmt.Printf("Error copying entry points: %v\n", err)
-		os.Exit(1)
+	// Starting CrowdSec created the container network, which is trusted too
+	updated, err := updateCrowdsecTrustedIPs(config)
+	if err != nil {
+		return fmt.Errorf("failed to update the CrowdSec trusted IPs: %v", err)
 	}
-	// delete the 2nd file
-	if err := os.Remove("config/crowdsec/dynamic_config.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+	if updated {
+		if err := restartContainer("crowdsec", containerType); err != nil {
+			return err
+		}
 	}
-
-	if err := os.Remove("config/crowdsec/docker-compose.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+	if err := waitForHealthy("crowdsec", containerType); err != nil {
+		return err
 	}
 
-	if err := CheckAndAddTraefikLogVolume("docker-compose.yml"); err != nil {
-		fmt.Printf("Error checking and adding Traefik log volume: %v\n", err)
-		os.Exit(1)
+	apiKey, err := GetCrowdSecAPIKey(containerType)
+	if err != nil {
+		// The bouncer may be left over from an interrupted install
+		if apiKey, err = RotateCrowdSecAPIKey(containerType); err != nil {
+			return fmt.Errorf("failed to get API key: %v", err)
+		}
 	}
 
-	// check and add the service dependency of crowdsec to traefik
-	if err := CheckAndAddCrowdsecDependency("docker-compose.yml"); err != nil {
-		fmt.Printf("Error adding crowdsec dependency to traefik: %v\n", err)
-		os.Exit(1)
+	if err := replaceInFile("config/traefik/dynamic_config.yml", bouncerKeyPlaceholder, apiKey); err != nil {
+		return fmt.Errorf("failed to replace bouncer key: %v", err)
 	}
+	return secureFile("config/traefik/dynamic_config.yml")
+}
 
-	if err := startContainers(config.InstallationContainerType); err != nil {
-		return fmt.Errorf("failed to start containers: %v", err)
+// installCrowdsec adds CrowdSec to an existing install and registers the
+// Traefik bouncer before starting the containers again.
+func installCrowdsec(config Config) error {
+	if err := stopContainers(config.InstallationContainerType); err != nil {
+		return fmt.Errorf("failed to stop containers: %v", err)
 	}
 
-	// get API key
-	apiKey, err := GetCrowdSecAPIKey(config.InstallationContainerType)
-	if err != nil {
-		return fmt.Errorf("failed to get API key: %v", err)
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
 	}
-	config.TraefikBouncerKey = apiKey
 
-	if err := replaceInFile("config/traefik/dynamic_config.yml", "PUT_YOUR_BOUNCER_KEY_HERE_OR_IT_WILL_NOT_WORK", config.TraefikBouncerKey); err != nil {
-		return fmt.Errorf("failed to replace bouncer key: %v", err)
+	// Only the CrowdSec templates, the rest of the config already exists
+	setCrowdsecTrustedIPs(&config)
+	if err := renderTemplateTree(config, func(path string) bool { return strings.Contains(path, "crowdsec") }); err != nil {
+		return fmt.Errorf("error creating config files: %v", err)
 	}
 
-	if err := restartContainer("traefik", config.InstallationContainerType); err != nil {
-		return fmt.Errorf("failed to restart containers: %v", err)
+	if err := saveTemplateBaseline(crowdsecTemplates); err != nil {
+		return fmt.Errorf("error recording the template baseline: %v", err)
+	}
+	if err := mergeCrowdsecConfigFiles("docker-compose.yml", config); err != nil {
+		return err
 	}
 
-	if checkIfTextInFile("config/traefik/dynamic_config.yml", "PUT_YOUR_BOUNCER_KEY_HERE_OR_IT_WILL_NOT_WORK") {
-		fmt.Println("Failed to replace bouncer key! Please retrieve the key and replace it in the config/traefik/dynamic_config.yml file using the following command:")
-		fmt.Println("	docker exec crowdsec cscli bouncers add traefik-bouncer")
+	if err := provisionCrowdsecBouncer(config); err != nil {
+		return err
 	}
 
+	if err := startContainers(config.InstallationContainerType); err != nil {
+		return fmt.Errorf("failed to start containers: %v", err)
+	}
 	return nil
 }
 
 func checkIsCrowdsecInstalledInCompose() bool {
-	// Read docker-compose.yml
-	content, err := os.ReadFile("docker-compose.yml")
+	compose, err := loadComposeFile("docker-compose.yml")
 	if err != nil {
 		return false
 	}
 
 	// Check for crowdsec service
-	return bytes.Contains(content, []byte("crowdsec:"))
+	return compose.HasService("crowdsec")
 }
 
 func GetCrowdSecAPIKey(containerType SupportedContainer) (string, error) {
@@ -116,8 +133,13 @@ func GetCrowdSecAPIKey(containerType SupportedContainer) (string, error) {
 		return "", fmt.Errorf("waiting for container: %w", err)
 	}
 
+	// The key only exists once the bouncer is registered
+	if dryRunCommand(string(containerType), "exec", "crowdsec", "cscli", "bouncers", "add", "traefik-bouncer", "-o", "raw") {
+		return "<key from cscli bouncers add>", nil
+	}
+
 	// Execute the command to get the API key
-	cmd := exec.Command("docker", "exec", "crowdsec", "cscli", "bouncers", "add", "traefik-bouncer", "-o", "raw")
+	cmd := exec.Command(string(containerType), "exec", "crowdsec", "cscli", "bouncers", "add", "traefik-bouncer", "-o", "raw")
 	var out bytes.Buffer
 	cmd.Stdout = &out
 
@@ -134,68 +156,28 @@ func GetCrowdSecAPIKey(containerType SupportedContainer) (string, error) {
 	return apiKey, nil
 }
 
-func checkIfTextInFile(file, text string) bool {
-	// Read file
-	content, err := os.ReadFile(file)
-	if err != nil {
-		return false
-	}
-
-	// Check for text
-	return bytes.Contains(content, []byte(text))
-}
-
-func CheckAndAddCrowdsecDependency(composePath string) error {
-	// Read the docker-compose.yml file
-	data, err := os.ReadFile(composePath)
-	if err != nil {
-		return fmt.Errorf("error reading compose file: %w", err)
-	}
-
-	// Parse YAML into a generic map
-	var compose map[string]interface{}
-	if err := yaml.Unmarshal(data, &compose); err != nil {
-		return fmt.Errorf("error parsing compose file: %w", err)
-	}
-
-	// Get services section
-	services, ok := compose["services"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("services section not found or invalid")
+// RotateCrowdSecAPIKey deletes the traefik bouncer and registers it again,
+// returning the newly issued key.
+func RotateCrowdSecAPIKey(containerType SupportedContainer) (string, error) {
+	if err := waitForContainer("crowdsec", containerType); err != nil {
+		return "", fmt.Errorf("waiting for container: %w", err)
 	}
 
-	// Get traefik service
-	traefik, ok := services["traefik"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("traefik service not found or invalid")
+	cmd := exec.Command(string(containerType), "exec", "crowdsec", "cscli", "bouncers", "delete", "traefik-bouncer")
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("deleting bouncer: %w", err)
 	}
 
-	// Get dependencies
-	dependsOn, ok := traefik["depends_on"].(map[string]interface{})
-	if ok {
-		// Append the new block for crowdsec
-		dependsOn["crowdsec"] = map[string]interface{}{
-			"condition": "service_healthy",
-		}
-	} else {
-		// No dependencies exist, create it
-		traefik["depends_on"] = map[string]interface{}{
-			"crowdsec": map[string]interface{}{
-				"condition": "service_healthy",
-			},
-		}
-	}
+	return GetCrowdSecAPIKey(containerType)
+}
 
-	// Marshal the modified data back to YAML with indentation
-	modifiedData, err := MarshalYAMLWithIndent(compose, 2) // Set indentation to 2 spaces
+func checkIfTextInFile(file, text string) bool {
+	// Read file
+	content, err := readFile(file)
 	if err != nil {
-		log.Fatalf("error marshaling YAML: %v", err)
-	}
-
-	if err := os.WriteFile(composePath, modifiedData, 0644); err != nil {
-		return fmt.Errorf("error writing updated compose file: %w", err)
+		return false
 	}
 
-	fmt.Println("Added dependency of crowdsec to traefik")
-	return nil
+	// Check for text
+	return bytes.Contains(content, []byte(text))
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// CrowdSec answers suspicious HTTP requests with captcha decisions, which
+// the bouncer can only serve with a captcha provider. Without one the
+// captcha profile is left out and those requests are banned instead.
+
+var (
+	flagCrowdsecCaptcha          = flag.String("crowdsec-captcha", "", "Captcha provider for CrowdSec captcha decisions: turnstile, hcaptcha, recaptcha, or none to ban instead")
+	flagCrowdsecCaptchaSiteKey   = flag.String("crowdsec-captcha-site-key", "", "Site key of the captcha provider")
+	flagCrowdsecCaptchaSecretKey = flag.String("crowdsec-captcha-secret-key", "", "Secret key of the captcha provider")
+)
+
+const captchaNone = "none"
+
+var captchaProviders = []string{"turnstile", "hcaptcha", "recaptcha"}
+
+// captchaVolume mounts the captcha page at the path the bouncer reads it
+// from.
+var captchaVolume = ComposeVolume{Type: "bind", Source: "./config/crowdsec/captcha.html", Target: "/captcha.html", ReadOnly: true}
+
+// collectCaptchaInput asks for the captcha provider and its keys.
+func collectCaptchaInput(reader *bufio.Reader, config *Config) {
+	config.CrowdsecCaptchaProvider, config.CrowdsecCaptchaSiteKey, config.CrowdsecCaptchaSecretKey = "", "", ""
+
+	provider := strings.ToLower(readValidatedStringFlag(reader, "crowdsec-captcha", "Which captcha provider should CrowdSec use? turnstile, hcaptcha, recaptcha, or none to ban instead", captchaNone, validateCaptchaProvider))
+	if provider == captchaNone {
+		fmt.Println("Requests that would have to solve a captcha are banned instead.")
+		return
+	}
+
+	config.CrowdsecCaptchaProvider = provider
+	config.CrowdsecCaptchaSiteKey = readValidatedStringFlag(reader, "crowdsec-captcha-site-key", "Enter the "+provider+" site key", "", validateRequired)
+	config.CrowdsecCaptchaSecretKey = readPasswordFlag(reader, "crowdsec-captcha-secret-key", "Enter the "+provider+" secret key")
+	if config.CrowdsecCaptchaSecretKey == "" {
+		// A terminal asks again for an empty password, so this is an empty
+		// flag or input that has ended
+		fmt.Println("Error: a secret key is required")
+		os.Exit(1)
+	}
+}
+
+func validateCaptchaProvider(value string) error {
+	value = strings.ToLower(value)
+	if value != captchaNone && !slices.Contains(captchaProviders, value) {
+		return fmt.Errorf("%q is not a captcha provider, use turnstile, hcaptcha, recaptcha or none", value)
+	}
+	return nil
+}
+
+// addCaptchaVolume mounts the captcha page into Traefik when a captcha
+// provider is configured.
+func addCaptchaVolume(compose *composeFile, config Config) error {
+	if config.CrowdsecCaptchaProvider == "" {
+		return nil
+	}
+	_, err := compose.addVolume("traefik", captchaVolume)
+	return err
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// crowdsecMiddleware is the bouncer middleware installCrowdsec puts on the
+// websecure entrypoint, so it runs in front of every HTTPS router.
+const crowdsecMiddleware = "crowdsec@file"
+
+// crowdsecCommand takes CrowdSec out of the request path, puts it back, or
+// removes it from the install, undoing what installCrowdsec merged in.
+func crowdsecCommand(args []string) error {
+	if len(args) != 1 || !slices.Contains([]string{"disable", "enable", "remove"}, args[0]) {
+		return fmt.Errorf("usage: installer crowdsec <disable|enable|remove>")
+	}
+	if !checkIsCrowdsecInstalledInCompose() {
+		return fmt.Errorf("CrowdSec is not installed")
+	}
+
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+
+	containerType := detectContainerType()
+	switch args[0] {
+	case "remove":
+		if err := removeCrowdsec(containerType); err != nil {
+			return err
+		}
+	default:
+		enabled := args[0] == "enable"
+		changed, err := setCrowdsecMiddleware("config/traefik/traefik_config.yml", enabled)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Printf("CrowdSec is already %sd.\n", args[0])
+			return nil
+		}
+	}
+
+	if err := recreateContainers(containerType, "traefik"); err != nil {
+		return err
+	}
+	if err := waitForHealthy("traefik", containerType); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "disable":
+		fmt.Println("CrowdSec no longer filters requests. It keeps running, run 'installer crowdsec enable' to turn the bouncer back on.")
+	case "enable":
+		fmt.Println("CrowdSec filters requests again.")
+	case "remove":
+		fmt.Println("CrowdSec removed. Its configuration and database are kept in config/crowdsec and Traefik's access logs in config/traefik/logs; delete the directories to remove them as well.")
+	}
+	return nil
+}
+
+// removeCrowdsec deregisters the bouncer, strips the CrowdSec middleware,
+// plugin and service from the Traefik and compose configs, and removes the
+// container.
+func removeCrowdsec(containerType SupportedContainer) error {
+	fmt.Println("\n=== Removing CrowdSec ===")
+
+	if isContainerRunning("crowdsec", containerType) {
+		cmd := exec.Command(string(containerType), "exec", "crowdsec", "cscli", "bouncers", "delete", "traefik-bouncer")
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("Warning: could not deregister the traefik bouncer: %v\n", err)
+		}
+	} else {
+		fmt.Println("CrowdSec is not running, the traefik bouncer stays registered in its database.")
+	}
+
+	if _, err := setCrowdsecMiddleware("config/traefik/traefik_config.yml", false); err != nil {
+		return err
+	}
+	if err := removeCrowdsecPlugin("config/traefik/traefik_config.yml"); err != nil {
+		return err
+	}
+	if err := removeCrowdsecMiddlewareConfig("config/traefik/dynamic_config.yml"); err != nil {
+		return err
+	}
+
+	compose, err := loadComposeFile("docker-compose.yml")
+	if err != nil {
+		return fmt.Errorf("error reading compose file: %w", err)
+	}
+	if err := compose.removeService("crowdsec"); err != nil {
+		return err
+	}
+	// Traefik only mounts these for CrowdSec, and they must not keep
+	// pointing at files the operator may delete now
+	for _, volume := range []ComposeVolume{captchaVolume, traefikLogsVolume} {
+		if _, err := compose.removeVolume("traefik", volume); err != nil {
+			return err
+		}
+	}
+	if err := compose.save(); err != nil {
+		return fmt.Errorf("error writing compose file: %w", err)
+	}
+
+	// The container is no longer in the compose file, so it is an orphan now
+	if containerType == Podman {
+		return run("podman-compose", "-f", "docker-compose.yml", "up", "-d", "--remove-orphans")
+	}
+	return executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "up", "-d", "--remove-orphans")
+}
+
+// setCrowdsecMiddleware adds the CrowdSec middleware to the websecure
+// entrypoint or removes it from every entrypoint. It reports whether the
+// file changed.
+func setCrowdsecMiddleware(path string, enabled bool) (bool, error) {
+	doc, original, err := readYAMLFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	entryPoints := yamlChildValue(doc.Content[0], "entryPoints")
+	changed := false
+	if enabled {
+		websecure := yamlChildValue(entryPoints, "websecure")
+		if websecure == nil {
+			return false, fmt.Errorf("websecure entrypoint not found in %s", path)
+		}
+		http, err := yamlChildMapping(websecure, "http")
+		if err != nil {
+			return false, err
+		}
+		middlewares := yamlChildValue(http, "middlewares")
+		if middlewares == nil || middlewares.Kind == yaml.ScalarNode && middlewares.Tag == "!!null" {
+			middlewares = &yaml.Node{Kind: yaml.SequenceNode}
+			setYAMLMappingValue(http, "middlewares", middlewares)
+		}
+		if middlewares.Kind != yaml.SequenceNode {
+			return false, fmt.Errorf("websecure middlewares are not a list in %s", path)
+		}
+		if !slices.ContainsFunc(middlewares.Content, isCrowdsecMiddleware) {
+			middlewares.Content = append(middlewares.Content, yamlScalar(crowdsecMiddleware))
+			changed = true
+		}
+	} else if entryPoints != nil {
+		for i := 1; i < len(entryPoints.Content); i += 2 {
+			http := yamlChildValue(entryPoints.Content[i], "http")
+			if removeCrowdsecReferences(http) {
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+	return true, writeYAMLFile(path, doc, original)
+}
+
+// removeCrowdsecPlugin drops the bouncer plugin and the access log CrowdSec
+// reads from the static config.
+func removeCrowdsecPlugin(path string) error {
+	doc, original, err := readYAMLFile(path)
+	if err != nil {
+		return err
+	}
+
+	plugins := yamlChildValue(yamlChildValue(doc.Content[0], "experimental"), "plugins")
+	removedPlugin := deleteYAMLMappingKey(plugins, "crowdsec")
+	removedLog := deleteYAMLMappingKey(doc.Content[0], "accessLog")
+	if !removedPlugin && !removedLog {
+		return nil
+	}
+	return writeYAMLFile(path, doc, original)
+}
+
+// removeCrowdsecMiddlewareConfig drops the bouncer middleware from the
+// dynamic config, along with any router still using it.
+func removeCrowdsecMiddlewareConfig(path string) error {
+	doc, original, err := readYAMLFile(path)
+	if err != nil {
+		return err
+	}
+
+	http := yamlChildValue(doc.Content[0], "http")
+	changed := deleteYAMLMappingKey(yamlChildValue(http, "middlewares"), "crowdsec")
+	if routers := yamlChildValue(http, "routers"); routers != nil {
+		for i := 1; i < len(routers.Content); i += 2 {
+			if removeCrowdsecReferences(routers.Content[i]) {
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return writeYAMLFile(path, doc, original)
+}
+
+// removeCrowdsecReferences removes the CrowdSec middleware from the
+// middlewares list of an entrypoint or router, dropping the list once it is
+// empty. It reports whether anything was removed.
+func removeCrowdsecReferences(node *yaml.Node) bool {
+	middlewares := yamlChildValue(node, "middlewares")
+	if middlewares == nil || middlewares.Kind != yaml.SequenceNode {
+		return false
+	}
+
+	count := len(middlewares.Content)
+	middlewares.Content = slices.DeleteFunc(middlewares.Content, isCrowdsecMiddleware)
+	if len(middlewares.Content) == 0 {
+		deleteYAMLMappingKey(node, "middlewares")
+	}
+	return len(middlewares.Content) != count
+}
+
+// isCrowdsecMiddleware matches the CrowdSec middleware with or without the
+// provider suffix, which routers in the file provider may leave out.
+func isCrowdsecMiddleware(node *yaml.Node) bool {
+	return node.Value == crowdsecMiddleware || node.Value == "crowdsec"
+}
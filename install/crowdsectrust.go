@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The CrowdSec bouncer trusts X-Forwarded-For only from the proxies in
+// forwardedHeadersTrustedIPs and never blocks the clients in
+// clientTrustedIPs. Both are derived from the networks of the install: the
+// Docker network the containers share, Gerbil's tunnel subnet, and the
+// upstream proxies and office ranges the operator names.
+
+var (
+	flagCrowdsecTrustedProxies = flag.String("crowdsec-trusted-proxies", "", "Comma separated CIDRs of proxies in front of Pangolin whose X-Forwarded-For CrowdSec trusts, or cloudflare for Cloudflare's published ranges")
+	flagCrowdsecTrustedClients = flag.String("crowdsec-trusted-clients", "", "Comma separated CIDRs of clients CrowdSec never blocks, e.g. office networks")
+)
+
+// defaultGerbilSubnetGroup is the subnet Pangolin hands out to Gerbil when
+// config.yml does not set gerbil.subnet_group.
+const defaultGerbilSubnetGroup = "100.89.137.0/20"
+
+// cloudflareProxies is the keyword for Cloudflare's published ranges in the
+// list of trusted proxies.
+const cloudflareProxies = "cloudflare"
+
+var cloudflareRangeURLs = []string{"https://www.cloudflare.com/ips-v4", "https://www.cloudflare.com/ips-v6"}
+
+// cloudflareFallbackRanges is used when the published ranges cannot be
+// downloaded.
+var cloudflareFallbackRanges = []string{
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+	"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+	"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+	"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+}
+
+// collectCrowdsecInput asks whether CrowdSec should be deployed, which
+// proxies and clients it trusts and how it serves captchas.
+func collectCrowdsecInput(reader *bufio.Reader, config *Config) {
+	config.DoCrowdsecInstall = readCrowdsecChoice(reader)
+	config.CrowdsecTrustedProxies, config.CrowdsecTrustedClients = nil, nil
+	config.CrowdsecCaptchaProvider, config.CrowdsecCaptchaSiteKey, config.CrowdsecCaptchaSecretKey = "", "", ""
+	if !config.DoCrowdsecInstall {
+		return
+	}
+
+	config.CrowdsecTrustedProxies = readCIDRListFlag(reader, "crowdsec-trusted-proxies", "Enter the CIDRs of any proxies in front of Pangolin, or cloudflare (leave empty for none)", true)
+	config.CrowdsecTrustedClients = readCIDRListFlag(reader, "crowdsec-trusted-clients", "Enter the CIDRs of any clients CrowdSec must never block, e.g. your office (leave empty for none)", false)
+	collectCaptchaInput(reader, config)
+}
+
+// readCIDRListFlag reads a comma separated CIDR list from a flag or prompt.
+// An invalid answer is asked again; an invalid flag exits.
+func readCIDRListFlag(reader *bufio.Reader, name string, prompt string, allowCloudflare bool) []string {
+	validate := func(value string) error {
+		_, err := parseCIDRList(value, allowCloudflare)
+		return err
+	}
+	list, _ := parseCIDRList(readValidatedStringFlag(reader, name, prompt, "", validate), allowCloudflare)
+	return list
+}
+
+// parseCIDRList parses a comma separated list of CIDRs. A bare address is
+// taken as a single host, and allowCloudflare accepts the cloudflare
+// keyword.
+func parseCIDRList(value string, allowCloudflare bool) ([]string, error) {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case allowCloudflare && strings.EqualFold(entry, cloudflareProxies):
+			entry = cloudflareProxies
+		case net.ParseIP(entry) != nil:
+			if net.ParseIP(entry).To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		default:
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a valid CIDR", entry)
+			}
+			entry = network.String()
+		}
+		if !slices.Contains(list, entry) {
+			list = append(list, entry)
+		}
+	}
+	return list, nil
+}
+
+// setCrowdsecTrustedIPs fills in the trusted lists the CrowdSec templates
+// render.
+func setCrowdsecTrustedIPs(config *Config) {
+	config.CrowdsecForwardedTrustedIPs, config.CrowdsecClientTrustedIPs = crowdsecTrustedIPs(*config)
+}
+
+// crowdsecTrustedIPs returns the proxies whose forwarded headers are trusted
+// and the clients that are never blocked. The Docker network only exists
+// once the first container was started, and the container type is only
+// chosen then, so before that it is left out.
+func crowdsecTrustedIPs(config Config) ([]string, []string) {
+	networks := dockerNetworkSubnets(config.InstallationContainerType, "pangolin")
+	if config.InstallGerbil {
+		networks = append(networks, gerbilSubnetGroup())
+	}
+
+	forwarded := slices.Clone(networks)
+	for _, proxy := range config.CrowdsecTrustedProxies {
+		if proxy == cloudflareProxies {
+			forwarded = append(forwarded, cloudflareRanges()...)
+		} else {
+			forwarded = append(forwarded, proxy)
+		}
+	}
+	clients := append(slices.Clone(networks), config.CrowdsecTrustedClients...)
+
+	return compactCIDRs(forwarded), compactCIDRs(clients)
+}
+
+// compactCIDRs drops duplicates, keeping the first occurrence.
+func compactCIDRs(list []string) []string {
+	var compacted []string
+	for _, entry := range list {
+		if !slices.Contains(compacted, entry) {
+			compacted = append(compacted, entry)
+		}
+	}
+	return compacted
+}
+
+// dockerNetworkSubnets returns the subnets of a container network of the
+// given container type, or none when the network does not exist yet.
+func dockerNetworkSubnets(containerType SupportedContainer, name string) []string {
+	var cmd *exec.Cmd
+	switch containerType {
+	case Docker:
+		cmd = exec.Command("docker", "network", "inspect", "-f", "{{range .IPAM.Config}}{{.Subnet}} {{end}}", name)
+	case Podman:
+		cmd = exec.Command("podman", "network", "inspect", "-f", "{{range .Subnets}}{{.Subnet}} {{end}}", name)
+	default:
+		return nil
+	}
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(out))
+}
+
+// gerbilSubnetGroup returns the subnet of the Gerbil tunnels from
+// config.yml, or Pangolin's default when it is not set.
+func gerbilSubnetGroup() string {
+	content, err := readFile("config/config.yml")
+	if err != nil {
+		return defaultGerbilSubnetGroup
+	}
+
+	var appConfig struct {
+		Gerbil struct {
+			SubnetGroup string `yaml:"subnet_group"`
+		} `yaml:"gerbil"`
+	}
+	if err := yaml.Unmarshal(content, &appConfig); err != nil || appConfig.Gerbil.SubnetGroup == "" {
+		return defaultGerbilSubnetGroup
+	}
+	return appConfig.Gerbil.SubnetGroup
+}
+
+// cloudflareRanges downloads Cloudflare's published ranges, falling back to
+// the ones known when this installer was built. A dry run only records the
+// downloads.
+func cloudflareRanges() []string {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var ranges []string
+	for _, url := range cloudflareRangeURLs {
+		if dryRunDownload(url) {
+			continue
+		}
+		resp, err := client.Get(url)
+		if err != nil {
+			fmt.Printf("Warning: could not download the Cloudflare ranges, using the built-in list: %v\n", err)
+			return cloudflareFallbackRanges
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			fmt.Printf("Warning: could not download the Cloudflare ranges from %s, using the built-in list\n", url)
+			return cloudflareFallbackRanges
+		}
+
+		list, err := parseCIDRList(strings.Join(strings.Fields(string(body)), ","), false)
+		if err != nil || len(list) == 0 {
+			fmt.Printf("Warning: unexpected Cloudflare ranges from %s, using the built-in list\n", url)
+			return cloudflareFallbackRanges
+		}
+		ranges = append(ranges, list...)
+	}
+	if isDryRun() {
+		// The downloads are only planned, render the built-in list meanwhile
+		return cloudflareFallbackRanges
+	}
+	return ranges
+}
+
+// updateCrowdsecTrustedIPs recomputes the trusted lists once the containers
+// exist and rewrites the bouncer middleware and the whitelist parser when
+// they changed. It reports whether anything was rewritten, in which case
+// CrowdSec has to be restarted to load the whitelist.
+func updateCrowdsecTrustedIPs(config Config) (bool, error) {
+	forwarded, clients, err := ReadCrowdsecTrustedIPs("config/traefik/dynamic_config.yml")
+	if err != nil {
+		return false, err
+	}
+
+	setCrowdsecTrustedIPs(&config)
+	if slices.Equal(forwarded, config.CrowdsecForwardedTrustedIPs) && slices.Equal(clients, config.CrowdsecClientTrustedIPs) {
+		return false, nil
+	}
+
+	doc, original, err := readYAMLFile("config/traefik/dynamic_config.yml")
+	if err != nil {
+		return false, err
+	}
+	plugin := yamlChildValue(yamlChildValue(yamlChildValue(yamlChildValue(yamlChildValue(doc.Content[0], "http"), "middlewares"), "crowdsec"), "plugin"), "crowdsec")
+	if plugin == nil {
+		return false, fmt.Errorf("CrowdSec middleware not found in config/traefik/dynamic_config.yml")
+	}
+	setYAMLMappingValue(plugin, "forwardedHeadersTrustedIPs", yamlStringList(config.CrowdsecForwardedTrustedIPs))
+	setYAMLMappingValue(plugin, "clientTrustedIPs", yamlStringList(config.CrowdsecClientTrustedIPs))
+	if err := writeYAMLFile("config/traefik/dynamic_config.yml", doc, original); err != nil {
+		return false, err
+	}
+
+	if err := renderConfigFile(crowdsecWhitelistPath, config); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// crowdsecWhitelistPath is the whitelist parser matching the bouncer's
+// trusted clients, so CrowdSec does not raise alerts for them either.
+const crowdsecWhitelistPath = "config/crowdsec/parsers/s02-enrich/pangolin-whitelist.yaml"
+
+func yamlStringList(values []string) *yaml.Node {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, value := range values {
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle})
+	}
+	return list
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCIDRList(t *testing.T) {
+	tests := []struct {
+		value           string
+		allowCloudflare bool
+		want            []string
+		err             string
+	}{
+		{value: "", want: nil},
+		{value: "10.0.0.0/8", want: []string{"10.0.0.0/8"}},
+		{value: " 10.1.2.3/8 , 192.168.1.0/24,", want: []string{"10.0.0.0/8", "192.168.1.0/24"}},
+		{value: "203.0.113.7, 2001:db8::1", want: []string{"203.0.113.7/32", "2001:db8::1/128"}},
+		{value: "2001:db8::/32,2001:db8::/32", want: []string{"2001:db8::/32"}},
+		{value: "Cloudflare,10.0.0.0/8", allowCloudflare: true, want: []string{"cloudflare", "10.0.0.0/8"}},
+		{value: "cloudflare", err: `"cloudflare" is not a valid CIDR`},
+		{value: "10.0.0.0/33", err: `"10.0.0.0/33" is not a valid CIDR`},
+		{value: "10.0.0.0/8,office", allowCloudflare: true, err: `"office" is not a valid CIDR`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseCIDRList(tt.value, tt.allowCloudflare)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
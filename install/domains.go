@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// BaseDomain is an entry of the domains section of config.yml. CertResolver
+// and PreferWildcardCert are left out of the file when unset so the server
+// falls back to the traefik section.
+type BaseDomain struct {
+	Name               string
+	Domain             string
+	CertResolver       string
+	PreferWildcardCert *bool
+}
+
+var flagBaseDomains = baseDomainsFlag{}
+
+func init() {
+	flag.Var(&flagBaseDomains, "base-domain", "Base domain as domain[,cert_resolver=name][,prefer_wildcard_cert=true] (repeatable)")
+}
+
+// baseDomainsFlag collects the repeatable --base-domain flag.
+type baseDomainsFlag []BaseDomain
+
+func (f *baseDomainsFlag) String() string {
+	domains := make([]string, 0, len(*f))
+	for _, d := range *f {
+		domains = append(domains, d.Domain)
+	}
+	return strings.Join(domains, ",")
+}
+
+func (f *baseDomainsFlag) Set(value string) error {
+	d, err := parseBaseDomain(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, d)
+	return nil
+}
+
+// String formats the domain in the syntax of --base-domain.
+func (d BaseDomain) String() string {
+	value := d.Domain
+	if d.CertResolver != "" {
+		value += ",cert_resolver=" + d.CertResolver
+	}
+	if d.PreferWildcardCert != nil {
+		value += ",prefer_wildcard_cert=" + strconv.FormatBool(*d.PreferWildcardCert)
+	}
+	return value
+}
+
+// parseBaseDomain parses a domain followed by optional comma separated
+// cert_resolver and prefer_wildcard_cert settings.
+func parseBaseDomain(value string) (BaseDomain, error) {
+	parts := strings.Split(value, ",")
+	d := BaseDomain{Domain: strings.ToLower(strings.TrimSpace(parts[0]))}
+	if !isDomainName(d.Domain) {
+		return d, fmt.Errorf("%q is not a valid domain name", d.Domain)
+	}
+
+	for _, option := range parts[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch key {
+		case "cert_resolver":
+			d.CertResolver = val
+		case "prefer_wildcard_cert":
+			wildcard, err := strconv.ParseBool(val)
+			if err != nil {
+				return d, fmt.Errorf("invalid prefer_wildcard_cert for %s: %q", d.Domain, val)
+			}
+			d.PreferWildcardCert = &wildcard
+		default:
+			return d, fmt.Errorf("unknown setting %q for %s, expected cert_resolver or prefer_wildcard_cert", key, d.Domain)
+		}
+	}
+	return d, nil
+}
+
+// collectBaseDomains returns the base domains given with --base-domain, or
+// asks for them.
+func collectBaseDomains(reader *bufio.Reader) []BaseDomain {
+	if len(flagBaseDomains) == 0 || reviewing {
+		return promptBaseDomains(reader)
+	}
+	return collectFlagBaseDomains()
+}
+
+// collectFlagBaseDomains returns the base domains given with --base-domain.
+func collectFlagBaseDomains() []BaseDomain {
+	domains := slices.Clone([]BaseDomain(flagBaseDomains))
+	seen := make(map[string]bool)
+	for i := range domains {
+		if seen[domains[i].Domain] {
+			fmt.Printf("Error: base domain %s is listed more than once\n", domains[i].Domain)
+			os.Exit(1)
+		}
+		seen[domains[i].Domain] = true
+		domains[i].Name = fmt.Sprintf("domain%d", i+1)
+	}
+	return domains
+}
+
+// parseBaseDomainList parses space separated base domains in the syntax of
+// --base-domain.
+func parseBaseDomainList(value string) ([]BaseDomain, error) {
+	var domains []BaseDomain
+	for _, entry := range strings.Fields(value) {
+		d, err := parseBaseDomain(entry)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(domains, func(other BaseDomain) bool { return other.Domain == d.Domain }) {
+			return nil, fmt.Errorf("%s is listed more than once", d.Domain)
+		}
+		d.Name = fmt.Sprintf("domain%d", len(domains)+1)
+		domains = append(domains, d)
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("at least one base domain is required")
+	}
+	return domains, nil
+}
+
+// promptBaseDomains asks for base domains until an empty answer. The first
+// one is required.
+func promptBaseDomains(reader *bufio.Reader) []BaseDomain {
+	var domains []BaseDomain
+	for {
+		prompt := "Enter your base domain (no subdomain e.g. example.com)"
+		if len(domains) > 0 {
+			prompt = "Enter another base domain (leave empty to finish)"
+		}
+		value, readErr := readString(reader, prompt, "")
+		if value == "" {
+			if len(domains) > 0 {
+				break
+			}
+			fmt.Println("Error: at least one base domain is required")
+			exitAtEOF(readErr)
+			continue
+		}
+		d, err := parseBaseDomain(value)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			exitAtEOF(readErr)
+			continue
+		}
+		if slices.ContainsFunc(domains, func(other BaseDomain) bool { return other.Domain == d.Domain }) {
+			fmt.Printf("Error: %s is already listed\n", d.Domain)
+			exitAtEOF(readErr)
+			continue
+		}
+		d.Name = fmt.Sprintf("domain%d", len(domains)+1)
+		domains = append(domains, d)
+	}
+
+	if readBool(reader, "Do you want to set a certificate resolver or wildcard certificates for the base domains?", false) {
+		for i := range domains {
+			domains[i].CertResolver, _ = readString(reader, fmt.Sprintf("Enter the certificate resolver for %s (leave empty for the default)", domains[i].Domain), "")
+			if readBool(reader, fmt.Sprintf("Prefer a wildcard certificate for %s? This needs a resolver using the DNS challenge", domains[i].Domain), false) {
+				wildcard := true
+				domains[i].PreferWildcardCert = &wildcard
+			}
+		}
+	}
+	return domains
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBaseDomain(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		value string
+		want  BaseDomain
+		err   string
+	}{
+		{value: "example.com", want: BaseDomain{Domain: "example.com"}},
+		{value: " Example.COM ", want: BaseDomain{Domain: "example.com"}},
+		{value: "example.com,cert_resolver=dns", want: BaseDomain{Domain: "example.com", CertResolver: "dns"}},
+		{value: "example.com, prefer_wildcard_cert=true", want: BaseDomain{Domain: "example.com", PreferWildcardCert: &yes}},
+		{value: "example.com,cert_resolver=dns,prefer_wildcard_cert=false", want: BaseDomain{Domain: "example.com", CertResolver: "dns", PreferWildcardCert: &no}},
+		{value: "localhost", err: `"localhost" is not a valid domain name`},
+		{value: "-bad.example.com", err: `"-bad.example.com" is not a valid domain name`},
+		{value: "example.com,prefer_wildcard_cert=maybe", err: `invalid prefer_wildcard_cert for example.com: "maybe"`},
+		{value: "example.com,wildcard=true", err: `unknown setting "wildcard" for example.com`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseBaseDomain(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			// The flag syntax round trips
+			if again, err := parseBaseDomain(got.String()); err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("%q parsed as %+v, %v", got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseBaseDomainList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+		err   string
+	}{
+		{value: "example.com", want: []string{"domain1=example.com"}},
+		{value: "example.com  example.org,cert_resolver=dns", want: []string{"domain1=example.com", "domain2=example.org,cert_resolver=dns"}},
+		{value: "", err: "at least one base domain is required"},
+		{value: "example.com EXAMPLE.com", err: "example.com is listed more than once"},
+		{value: "example.com bad", err: `"bad" is not a valid domain name`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			domains, err := parseBaseDomainList(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range domains {
+				got = append(got, d.Name+"="+d.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// driftFile is an embedded template and the file it renders to on an install.
+type driftFile struct {
+	template string
+	path     string
+}
+
+var driftFiles = []driftFile{
+	{template: "config/config.yml", path: "config/config.yml"},
+	{template: "config/traefik/traefik_config.yml", path: "config/traefik/traefik_config.yml"},
+	{template: "config/traefik/dynamic_config.yml", path: "config/traefik/dynamic_config.yml"},
+	{template: "config/docker-compose.yml", path: "docker-compose.yml"},
+	{template: privateConfigPath, path: privateConfigPath},
+}
+
+// crowdsecTemplates are merged into the files of driftFiles when the install
+// runs CrowdSec.
+var crowdsecTemplates = []string{"config/crowdsec/docker-compose.yml", "config/crowdsec/traefik_config.yml", "config/crowdsec/dynamic_config.yml"}
+
+// templateBaselineDir keeps a copy of the templates an install was rendered
+// from, laid out like a --templates directory. Rendering it with the values
+// of the install again tells local edits from later template changes.
+const templateBaselineDir = "config/installer-baseline"
+
+type driftKind int
+
+const (
+	driftMissing driftKind = iota // in the template, not in the install
+	driftAdded                    // in the install, not in the template
+	driftChanged                  // in both with different values
+)
+
+// driftOrigin is where a change comes from, known when the install has a
+// template baseline.
+type driftOrigin int
+
+const (
+	originUnknown  driftOrigin = iota // no baseline recorded
+	originLocal                       // edited on the install
+	originTemplate                    // changed in the templates since the install
+	originBoth                        // edited on the install and in the templates
+)
+
+type driftChange struct {
+	kind     driftKind
+	origin   driftOrigin
+	path     string
+	template interface{}
+	current  interface{}
+}
+
+// diffCommand renders the templates with the values of the install in the
+// current directory and prints how the files on disk differ from them.
+func diffCommand(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: installer diff")
+	}
+	if _, err := os.Stat("config/config.yml"); err != nil {
+		return fmt.Errorf("no Pangolin install found in the current directory")
+	}
+
+	config, err := recoverConfig()
+	if err != nil {
+		return err
+	}
+	rendered, err := renderInstallTemplates(templates, config)
+	if err != nil {
+		return err
+	}
+	var baseline map[string][]byte
+	if info, err := os.Stat(templateBaselineDir); err == nil && info.IsDir() {
+		baseline, err = renderInstallTemplates(overlayFS{base: templates, override: os.DirFS(templateBaselineDir)}, config)
+		if err != nil {
+			return fmt.Errorf("error rendering the template baseline: %v", err)
+		}
+	} else {
+		fmt.Println("No template baseline is recorded for this install, so local edits cannot be told apart from template changes.")
+	}
+	redact := secretRedactor(config)
+
+	drifted := 0
+	for _, f := range driftFiles {
+		want, ok := rendered[f.path]
+		if !ok {
+			continue
+		}
+
+		current, err := os.ReadFile(f.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("\n=== %s ===\nMissing, the installer would create it.\n", f.path)
+			drifted++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", f.path, err)
+		}
+
+		changes, err := compareYAMLFiles(want, current)
+		if err != nil {
+			return fmt.Errorf("error comparing %s: %v", f.path, err)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if base, ok := baseline[f.path]; ok && hasTemplateBaseline(f.template) {
+			if err := classifyDrift(changes, base, want, current); err != nil {
+				return fmt.Errorf("error comparing %s with its baseline: %v", f.path, err)
+			}
+		}
+		printDrift(f.path, changes, redact)
+		drifted++
+	}
+
+	if drifted == 0 {
+		fmt.Println("The install matches the installer's templates.")
+	}
+	return nil
+}
+
+// recoverConfig rebuilds the installer configuration of an existing install
+// from its config files and compose file.
+func recoverConfig() (Config, error) {
+	config := Config{SecretsMode: detectSecretsMode(), Vars: templateVars}
+
+	appConfig, err := ReadAppConfig("config/config.yml")
+	if err != nil {
+		return config, err
+	}
+	parsedURL, err := url.Parse(appConfig.DashboardURL)
+	if err != nil {
+		return config, fmt.Errorf("error parsing dashboard URL: %v", err)
+	}
+	config.DashboardDomain = parsedURL.Hostname()
+	config.BaseDomains = appConfig.BaseDomains
+	config.Secret = appConfig.Secret
+	config.EnableGeoblocking = appConfig.MaxMindDBPath != ""
+	config.EnableASN = appConfig.MaxMindASNPath != ""
+	config.EnableEmail = appConfig.SMTPHost != ""
+	config.EmailSMTPHost = appConfig.SMTPHost
+	config.EmailSMTPPort = appConfig.SMTPPort
+	config.EmailSMTPUser = appConfig.SMTPUser
+	config.EmailSMTPPass = appConfig.SMTPPass
+	config.EmailSMTPSecure = appConfig.SMTPSecure
+	config.EmailSMTPTLSRejectUnauthorized = appConfig.SMTPTLSRejectUnauthorized
+	config.EmailNoReply = appConfig.NoReply
+
+	traefikConfig, err := ReadTraefikConfig("config/traefik/traefik_config.yml")
+	if err != nil {
+		return config, err
+	}
+	config.LetsEncryptEmail = traefikConfig.LetsEncryptEmail
+	config.BadgerVersion = traefikConfig.BadgerVersion
+
+	compose, err := loadComposeFile("docker-compose.yml")
+	if err != nil {
+		return config, fmt.Errorf("error reading compose file: %w", err)
+	}
+	pangolinTag := imageTag(compose.Services["pangolin"].Image)
+	config.IsEnterprise = strings.HasPrefix(pangolinTag, "ee-")
+	config.PangolinVersion = strings.TrimPrefix(pangolinTag, "ee-")
+	config.InstallGerbil = compose.HasService("gerbil")
+	config.GerbilVersion = imageTag(compose.Services["gerbil"].Image)
+	config.InstallRedis = compose.HasService("redis")
+	config.EnableIPv6 = compose.Networks["default"].EnableIPv6
+
+	if compose.HasService("crowdsec") {
+		config.DoCrowdsecInstall = true
+		if config.TraefikBouncerKey, err = ReadBouncerKey("config/traefik/dynamic_config.yml"); err != nil {
+			return config, err
+		}
+		plugin, err := readCrowdsecPluginConfig("config/traefik/dynamic_config.yml")
+		if err != nil {
+			return config, err
+		}
+		config.CrowdsecForwardedTrustedIPs, config.CrowdsecClientTrustedIPs = plugin.ForwardedHeadersTrustedIPs, plugin.ClientTrustedIPs
+		config.CrowdsecCaptchaProvider = plugin.CaptchaProvider
+		config.CrowdsecCaptchaSiteKey, config.CrowdsecCaptchaSecretKey = plugin.CaptchaSiteKey, plugin.CaptchaSecretKey
+	}
+
+	if config.IsEnterprise {
+		privateConfig, err := ReadPrivateConfig(privateConfigPath)
+		if err != nil {
+			return config, err
+		}
+		config.EnableRedis = privateConfig.Flags.EnableRedis
+		config.RedisHost = privateConfig.Redis.Host
+		config.RedisPort = privateConfig.Redis.Port
+		if config.RedisPassword, err = readRedisPassword(config.SecretsMode); err != nil {
+			return config, err
+		}
+		config.RedisDB = privateConfig.Redis.DB
+		for _, replica := range privateConfig.Redis.Replicas {
+			config.RedisReplicas = append(config.RedisReplicas, RedisNode{Host: replica.Host, Port: replica.Port})
+		}
+
+		branding := privateConfig.Branding
+		config.EnableBranding = branding != (PrivateConfig{}).Branding
+		config.BrandingAppName = branding.AppName
+		config.BrandingPrimaryColorLight = branding.Colors.Light.Primary
+		config.BrandingPrimaryColorDark = branding.Colors.Dark.Primary
+		config.BrandingLogoLightPath = branding.Logo.LightPath
+		config.BrandingLogoDarkPath = branding.Logo.DarkPath
+	}
+
+	return config, nil
+}
+
+// imageTag returns the tag of an image reference.
+func imageTag(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if _, tag, ok := strings.Cut(name, ":"); ok {
+		return tag
+	}
+	return ""
+}
+
+// installTemplates returns the templates of driftFiles an install with
+// config is rendered from, including the CrowdSec ones it merges.
+func installTemplates(config Config) []string {
+	var names []string
+	for _, f := range driftFiles {
+		if f.template == privateConfigPath && !config.IsEnterprise {
+			continue
+		}
+		names = append(names, f.template)
+	}
+	if config.DoCrowdsecInstall {
+		names = append(names, crowdsecTemplates...)
+	}
+	return names
+}
+
+// saveTemplateBaseline copies the named templates to templateBaselineDir,
+// replacing the copies of an earlier run.
+func saveTemplateBaseline(names []string) error {
+	for _, name := range names {
+		content, err := fs.ReadFile(templates, name)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(templateBaselineDir, strings.TrimPrefix(name, "config/"))
+		if err := mkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(path, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasTemplateBaseline reports whether the baseline holds a copy of the
+// template, rather than falling back to the current one.
+func hasTemplateBaseline(name string) bool {
+	_, err := os.Stat(filepath.Join(templateBaselineDir, strings.TrimPrefix(name, "config/")))
+	return err == nil
+}
+
+// renderInstallTemplates renders the templates of driftFiles from fsys the
+// way the installer would have written them, including the CrowdSec changes
+// when the install runs CrowdSec. The result is keyed by the path on the
+// install.
+func renderInstallTemplates(fsys fs.FS, config Config) (map[string][]byte, error) {
+	dir, err := os.MkdirTemp("", "pangolin-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, template := range installTemplates(config) {
+		content, err := renderTemplateFrom(fsys, template, config)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, template)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.DoCrowdsecInstall {
+		if err := applyCrowdsecTemplates(dir, "config/docker-compose.yml", config); err != nil {
+			return nil, fmt.Errorf("error applying the CrowdSec templates: %v", err)
+		}
+	}
+
+	rendered := make(map[string][]byte)
+	for _, f := range driftFiles {
+		content, err := os.ReadFile(filepath.Join(dir, f.template))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		rendered[f.path] = content
+	}
+	return rendered, nil
+}
+
+// applyCrowdsecTemplates merges the CrowdSec templates rendered in dir into
+// the Traefik configs and the compose file at composePath, relative to dir.
+func applyCrowdsecTemplates(dir, composePath string, config Config) error {
+	path := func(template string) string {
+		return filepath.Join(dir, template)
+	}
+
+	for _, name := range []string{"traefik_config.yml", "dynamic_config.yml"} {
+		if err := MergeYAML(path("config/traefik/"+name), path("config/crowdsec/"+name)); err != nil {
+			return err
+		}
+	}
+	if config.TraefikBouncerKey != "" {
+		if err := replaceInFile(path("config/traefik/dynamic_config.yml"), bouncerKeyPlaceholder, config.TraefikBouncerKey); err != nil {
+			return err
+		}
+	}
+
+	source, err := loadComposeFile(path("config/crowdsec/docker-compose.yml"))
+	if err != nil {
+		return err
+	}
+	service, err := source.serviceNode("crowdsec")
+	if err != nil {
+		return err
+	}
+	compose, err := loadComposeFile(path(composePath))
+	if err != nil {
+		return err
+	}
+	if err := compose.setService("crowdsec", copyYAMLNode(service)); err != nil {
+		return err
+	}
+	if _, err := compose.addVolume("traefik", traefikLogsVolume); err != nil {
+		return err
+	}
+	if err := addCaptchaVolume(compose, config); err != nil {
+		return err
+	}
+	if err := compose.addDependency("traefik", "crowdsec", "service_healthy"); err != nil {
+		return err
+	}
+	return compose.save()
+}
+
+// compareYAMLFiles compares the values of two YAML documents. Mappings are
+// compared key by key and lists as sets, so reordering and formatting are
+// not reported.
+func compareYAMLFiles(template, current []byte) ([]driftChange, error) {
+	var want, got interface{}
+	if err := yaml.Unmarshal(template, &want); err != nil {
+		return nil, fmt.Errorf("template: %v", err)
+	}
+	if err := yaml.Unmarshal(current, &got); err != nil {
+		return nil, err
+	}
+
+	var changes []driftChange
+	compareYAMLValues("", want, got, &changes)
+	return changes, nil
+}
+
+func compareYAMLValues(path string, want, got interface{}, changes *[]driftChange) {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(want)+len(got))
+		for key := range want {
+			keys = append(keys, key)
+		}
+		for key := range got {
+			if _, ok := want[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			wantValue, inTemplate := want[key]
+			gotValue, inInstall := got[key]
+			switch {
+			case !inInstall:
+				*changes = append(*changes, driftChange{kind: driftMissing, path: keyPath, template: wantValue})
+			case !inTemplate:
+				*changes = append(*changes, driftChange{kind: driftAdded, path: keyPath, current: gotValue})
+			default:
+				compareYAMLValues(keyPath, wantValue, gotValue, changes)
+			}
+		}
+		return
+
+	case []interface{}:
+		got, ok := got.([]interface{})
+		if !ok {
+			break
+		}
+
+		for _, item := range want {
+			if !containsYAMLValue(got, item) {
+				*changes = append(*changes, driftChange{kind: driftMissing, path: path + "[]", template: item})
+			}
+		}
+		for _, item := range got {
+			if !containsYAMLValue(want, item) {
+				*changes = append(*changes, driftChange{kind: driftAdded, path: path + "[]", current: item})
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		*changes = append(*changes, driftChange{kind: driftChanged, path: path, template: want, current: got})
+	}
+}
+
+func containsYAMLValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyDrift sets the origin of the changes between a template and the
+// install from the baseline, the same file rendered from the templates of
+// the install. A change the install made to the baseline is a local edit, a
+// change the template made to it comes from the templates.
+func classifyDrift(changes []driftChange, baseline, template, current []byte) error {
+	local, err := compareYAMLFiles(baseline, current)
+	if err != nil {
+		return err
+	}
+	upstream, err := compareYAMLFiles(baseline, template)
+	if err != nil {
+		return err
+	}
+
+	for i := range changes {
+		inLocal, inTemplate := overlapsDrift(local, changes[i]), overlapsDrift(upstream, changes[i])
+		switch {
+		case inLocal && inTemplate:
+			changes[i].origin = originBoth
+		case inTemplate:
+			changes[i].origin = originTemplate
+		default:
+			changes[i].origin = originLocal
+		}
+	}
+	return nil
+}
+
+// overlapsDrift reports whether one of changes touches the same value as
+// change. List items are matched by value, other values by path, including
+// the values above and below it.
+func overlapsDrift(changes []driftChange, change driftChange) bool {
+	for _, other := range changes {
+		if other.path == change.path && strings.HasSuffix(change.path, "[]") {
+			if reflect.DeepEqual(other.value(), change.value()) {
+				return true
+			}
+			continue
+		}
+		short, long := other.path, change.path
+		if len(short) > len(long) {
+			short, long = long, short
+		}
+		if short == long || strings.HasPrefix(long, short+".") || strings.HasPrefix(long, short+"[]") {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the value the change is about, from the template when the
+// install lacks it.
+func (c driftChange) value() interface{} {
+	if c.kind == driftMissing {
+		return c.template
+	}
+	return c.current
+}
+
+// printDrift prints the changes of one file grouped by their origin, or by
+// kind when the install has no template baseline.
+func printDrift(path string, changes []driftChange, redact func(string) string) {
+	fmt.Printf("\n=== %s ===\n", path)
+
+	groups := []struct {
+		match func(driftChange) bool
+		title string
+	}{
+		{func(c driftChange) bool { return c.origin == originLocal }, "Edited on this install:"},
+		{func(c driftChange) bool { return c.origin == originTemplate }, "Changed in the templates since the install:"},
+		{func(c driftChange) bool { return c.origin == originBoth }, "Edited on this install and changed in the templates:"},
+		{func(c driftChange) bool { return c.origin == originUnknown && c.kind == driftMissing }, "Only in the template:"},
+		{func(c driftChange) bool { return c.origin == originUnknown && c.kind == driftAdded }, "Only in this install:"},
+		{func(c driftChange) bool { return c.origin == originUnknown && c.kind == driftChanged }, "Different values:"},
+	}
+	for _, group := range groups {
+		printed := false
+		for _, change := range changes {
+			if !group.match(change) {
+				continue
+			}
+			if !printed {
+				fmt.Println(group.title)
+				printed = true
+			}
+
+			var line string
+			switch change.kind {
+			case driftMissing:
+				line = fmt.Sprintf("  - %s (template: %s)", change.path, formatDriftValue(change.template))
+			case driftAdded:
+				line = fmt.Sprintf("  + %s: %s", change.path, formatDriftValue(change.current))
+			case driftChanged:
+				line = fmt.Sprintf("  ~ %s: %s (template: %s)", change.path, formatDriftValue(change.current), formatDriftValue(change.template))
+			}
+			fmt.Println(redact(line))
+		}
+	}
+}
+
+// formatDriftValue formats a value as single line YAML.
+func formatDriftValue(value interface{}) string {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	node.Style = yaml.FlowStyle
+	out, err := yaml.Marshal(&node)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+var flagDryRun = flag.Bool("dry-run", false, "Run the installation without changing anything and print the file diffs, commands and downloads it would make")
+
+// dryRunPlan records what a dry run would have done. Files written during the
+// run live in memory, so later steps read what earlier steps would have
+// written, and are diffed against the disk at the end.
+type dryRunPlan struct {
+	files     map[string][]byte // a nil value marks a removed file
+	order     []string
+	hidden    map[string]bool
+	commands  []string
+	downloads []string
+}
+
+var plan = dryRunPlan{
+	files:  make(map[string][]byte),
+	hidden: make(map[string]bool),
+}
+
+func isDryRun() bool {
+	return *flagDryRun
+}
+
+// readFile reads a file, seeing the changes of a dry run.
+func readFile(path string) ([]byte, error) {
+	if isDryRun() {
+		if data, ok := plan.files[path]; ok {
+			if data == nil {
+				return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+			}
+			return data, nil
+		}
+	}
+	return os.ReadFile(path)
+}
+
+// fileExists reports whether a file exists, seeing the changes of a dry run.
+func fileExists(path string) bool {
+	_, err := readFile(path)
+	return err == nil
+}
+
+// writeFile writes a file, or records it in a dry run.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if isDryRun() {
+		plan.setFile(path, append([]byte{}, data...))
+		return nil
+	}
+	return os.WriteFile(path, data, perm)
+}
+
+// writeHiddenFile writes a file whose contents must not show up in the plan.
+func writeHiddenFile(path string, data []byte, perm os.FileMode) error {
+	if isDryRun() {
+		plan.hidden[path] = true
+	}
+	return writeFile(path, data, perm)
+}
+
+// removeFile removes a file, or records its removal in a dry run.
+func removeFile(path string) error {
+	if isDryRun() {
+		if !fileExists(path) {
+			return &fs.PathError{Op: "remove", Path: path, Err: fs.ErrNotExist}
+		}
+		plan.setFile(path, nil)
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// mkdirAll creates a directory unless this is a dry run.
+func mkdirAll(path string, perm os.FileMode) error {
+	if isDryRun() {
+		return nil
+	}
+	return os.MkdirAll(path, perm)
+}
+
+func (p *dryRunPlan) setFile(path string, data []byte) {
+	if _, ok := p.files[path]; !ok {
+		p.order = append(p.order, path)
+	}
+	p.files[path] = data
+}
+
+// dryRunCommand records an external command in a dry run and reports
+// whether the caller should skip running it.
+func dryRunCommand(name string, args ...string) bool {
+	if !isDryRun() {
+		return false
+	}
+
+	words := []string{name}
+	for _, arg := range args {
+		if strings.ContainsAny(arg, " \t\n\"'$&|;<>*") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		words = append(words, arg)
+	}
+	plan.commands = append(plan.commands, strings.Join(words, " "))
+	return true
+}
+
+// dryRunDownload records a download in a dry run and reports whether the
+// caller should skip it.
+func dryRunDownload(url string) bool {
+	if !isDryRun() {
+		return false
+	}
+	plan.downloads = append(plan.downloads, url)
+	return true
+}
+
+// secretRedactor returns a function replacing the secrets of config in a
+// string, for output that may be shared.
+func secretRedactor(config Config) func(string) string {
+	var secrets []string
+	for _, s := range []string{config.Secret, config.EmailSMTPPass, config.RedisPassword, config.MaxMind.LicenseKey, config.TraefikBouncerKey} {
+		if len(s) >= 4 {
+			secrets = append(secrets, s)
+		}
+	}
+	return func(s string) string {
+		for _, secret := range secrets {
+			s = strings.ReplaceAll(s, secret, "<redacted>")
+		}
+		return s
+	}
+}
+
+// printDryRunPlan prints the diffs of every file the run would have changed,
+// followed by the commands and downloads. Secrets from the config are
+// replaced so the plan can be shared for review.
+func printDryRunPlan(config Config) {
+	redact := secretRedactor(config)
+
+	fmt.Println("\n=== Dry run: planned changes ===")
+	fmt.Println("Nothing was changed on this system.")
+
+	fmt.Println("\nFiles:")
+	changed := 0
+	for _, path := range plan.order {
+		planned := plan.files[path]
+		current, err := os.ReadFile(path)
+		exists := err == nil
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("  %s: cannot read the current file: %v\n", path, err)
+			continue
+		}
+
+		switch {
+		case planned == nil && !exists:
+			continue
+		case planned == nil:
+			fmt.Printf("\n  remove %s\n", path)
+		case plan.hidden[path]:
+			if exists && string(current) == string(planned) {
+				continue
+			}
+			fmt.Printf("\n  write %s (contents hidden, it holds secrets)\n", path)
+		default:
+			oldName := path
+			if !exists {
+				oldName = "/dev/null"
+			}
+			diff := unifiedDiff(oldName, path, current, planned)
+			if diff == "" {
+				continue
+			}
+			fmt.Println()
+			fmt.Print(redact(diff))
+		}
+		changed++
+	}
+	if changed == 0 {
+		fmt.Println("  (no changes)")
+	}
+
+	fmt.Println("\nCommands:")
+	if len(plan.commands) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, command := range plan.commands {
+		fmt.Printf("  %s\n", redact(command))
+	}
+
+	fmt.Println("\nDownloads:")
+	if len(plan.downloads) == 0 {
+		fmt.Println("  (none)")
+	}
+	downloads := append([]string{}, plan.downloads...)
+	sort.Strings(downloads)
+	for _, url := range downloads {
+		fmt.Printf("  %s\n", url)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	flagEmail                     = flag.Bool("email", false, "Enable email functionality (SMTP)")
+	flagSMTPProvider              = flag.String("smtp-provider", "", "SMTP provider preset: gmail, microsoft365, ses, mailgun, postmark or generic")
+	flagSMTPRegion                = flag.String("smtp-region", "", "AWS region of the SES SMTP endpoint")
+	flagSMTPHost                  = flag.String("smtp-host", "", "SMTP host for the generic provider")
+	flagSMTPPort                  = flag.Int("smtp-port", 587, "SMTP port for the generic provider")
+	flagSMTPSecure                = flag.Bool("smtp-secure", false, "Use implicit TLS instead of STARTTLS for the generic provider")
+	flagSMTPUser                  = flag.String("smtp-user", "", "SMTP username")
+	flagSMTPPassword              = flag.String("smtp-password", "", "SMTP password")
+	flagSMTPNoReply               = flag.String("smtp-no-reply", "", "No-reply email address")
+	flagSMTPTLSRejectUnauthorized = flag.Bool("smtp-tls-reject-unauthorized", true, "Reject SMTP servers with an invalid TLS certificate")
+	flagSMTPTest                  = flag.Bool("smtp-test", true, "Test the SMTP connection and credentials before writing the config")
+	flagSMTPTestRecipient         = flag.String("smtp-test-recipient", "", "Send a test email to this address after a successful connection test")
+)
+
+// smtpProvider is a preset for a common mail provider. A zero Port means the
+// host and port have to be entered by hand.
+type smtpProvider struct {
+	name   string
+	label  string
+	host   string
+	port   int
+	secure bool
+}
+
+var smtpProviders = []smtpProvider{
+	{name: "gmail", label: "Gmail / Google Workspace", host: "smtp.gmail.com", port: 587},
+	{name: "microsoft365", label: "Microsoft 365", host: "smtp.office365.com", port: 587},
+	{name: "ses", label: "Amazon SES", host: "email-smtp.%s.amazonaws.com", port: 587},
+	{name: "mailgun", label: "Mailgun", host: "smtp.mailgun.org", port: 587},
+	{name: "postmark", label: "Postmark", host: "smtp.postmarkapp.com", port: 587},
+	{name: "generic", label: "Other SMTP server"},
+}
+
+// collectEmailInput asks for the SMTP settings, starting from a provider
+// preset, and tests them before anything is written to disk.
+func collectEmailInput(reader *bufio.Reader, config *Config) {
+	fmt.Println("\n=== Email Configuration ===")
+	config.EnableEmail = readBoolFlag(reader, "email", "Enable email functionality (SMTP)", false)
+	if !config.EnableEmail {
+		return
+	}
+
+	for {
+		provider := readSMTPProvider(reader)
+
+		switch {
+		case provider.name == "ses":
+			region := readStringFlag(reader, "smtp-region", "Enter the AWS region of your SES endpoint", "us-east-1")
+			config.EmailSMTPHost = fmt.Sprintf(provider.host, region)
+			config.EmailSMTPPort = provider.port
+			config.EmailSMTPSecure = provider.secure
+		case provider.port != 0:
+			config.EmailSMTPHost = provider.host
+			config.EmailSMTPPort = provider.port
+			config.EmailSMTPSecure = provider.secure
+		default:
+			config.EmailSMTPHost = readValidatedStringFlag(reader, "smtp-host", "Enter SMTP host", "", validateRequired)
+			config.EmailSMTPPort = readPortFlag(reader, "smtp-port", "Enter SMTP port (default 587)", 587)
+			// Port 465 expects TLS from the first byte, everything else upgrades with STARTTLS
+			config.EmailSMTPSecure = readBoolFlag(reader, "smtp-secure", "Does the server use implicit TLS instead of STARTTLS?", config.EmailSMTPPort == 465)
+		}
+
+		config.EmailSMTPUser = readStringFlag(reader, "smtp-user", "Enter SMTP username", "")
+		config.EmailSMTPPass = readPasswordFlag(reader, "smtp-password", "Enter SMTP password")
+		config.EmailNoReply = readValidatedStringFlag(reader, "smtp-no-reply", "Enter no-reply email address (often the same as SMTP username)", config.EmailSMTPUser, validateEmail)
+		config.EmailSMTPTLSRejectUnauthorized = readBoolFlag(reader, "smtp-tls-reject-unauthorized", "Reject SMTP servers with an invalid TLS certificate?", true)
+
+		if !*flagSMTPTest {
+			return
+		}
+
+		fmt.Printf("Testing the connection to %s:%d...\n", config.EmailSMTPHost, config.EmailSMTPPort)
+		err := testSMTPConnection(*config)
+		if err == nil {
+			fmt.Println("SMTP connection and authentication succeeded!")
+			sendSMTPTestEmail(reader, *config)
+			return
+		}
+
+		fmt.Printf("SMTP test failed: %v\n", err)
+		if flagIsSet("smtp-host") || flagIsSet("smtp-provider") {
+			os.Exit(1)
+		}
+		if !readBool(reader, "Would you like to re-enter the SMTP settings?", true) {
+			fmt.Println("Keeping the SMTP settings as entered. Email delivery may not work.")
+			return
+		}
+	}
+}
+
+// readSMTPProvider asks which provider preset to start from.
+func readSMTPProvider(reader *bufio.Reader) smtpProvider {
+	if !flagIsSet("smtp-provider") {
+		fmt.Println("Choose your email provider:")
+		for _, p := range smtpProviders {
+			fmt.Printf("  %-13s %s\n", p.name, p.label)
+		}
+	}
+
+	for {
+		name := strings.ToLower(readStringFlag(reader, "smtp-provider", "Email provider", "generic"))
+		for _, p := range smtpProviders {
+			if p.name == name {
+				return p
+			}
+		}
+		fmt.Printf("Unrecognized email provider: %s.\n", name)
+		if flagIsSet("smtp-provider") {
+			os.Exit(1)
+		}
+	}
+}
+
+// dialSMTP opens an SMTP session the same way the server will: implicit TLS
+// when smtp_secure is set, otherwise a plain connection upgraded with
+// STARTTLS whenever the server offers it.
+func dialSMTP(config Config) (*smtp.Client, error) {
+	addr := net.JoinHostPort(config.EmailSMTPHost, strconv.Itoa(config.EmailSMTPPort))
+	tlsConfig := &tls.Config{
+		ServerName:         config.EmailSMTPHost,
+		InsecureSkipVerify: !config.EmailSMTPTLSRejectUnauthorized,
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if config.EmailSMTPSecure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, config.EmailSMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+
+	if !config.EmailSMTPSecure {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, fmt.Errorf("STARTTLS failed: %v", err)
+			}
+		}
+	}
+
+	if config.EmailSMTPUser != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("server does not support authentication")
+		}
+		auth := smtp.PlainAuth("", config.EmailSMTPUser, config.EmailSMTPPass, config.EmailSMTPHost)
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+
+	return client, nil
+}
+
+// testSMTPConnection connects and authenticates without sending anything.
+func testSMTPConnection(config Config) error {
+	client, err := dialSMTP(config)
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// sendSMTPTestEmail optionally sends an email from the no-reply address.
+func sendSMTPTestEmail(reader *bufio.Reader, config Config) {
+	recipient := *flagSMTPTestRecipient
+	if !flagIsSet("smtp-test-recipient") {
+		if !readBool(reader, "Would you like to send a test email?", false) {
+			return
+		}
+		recipient, _ = readString(reader, "Enter the address to send the test email to", config.LetsEncryptEmail)
+	}
+	if recipient == "" {
+		return
+	}
+
+	client, err := dialSMTP(config)
+	if err != nil {
+		fmt.Printf("Failed to send test email: %v\n", err)
+		return
+	}
+	defer client.Close()
+
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Pangolin SMTP test\r\nDate: %s\r\n\r\nThis is a test email sent by the Pangolin installer. Your SMTP settings work.\r\n",
+		config.EmailNoReply, recipient, time.Now().Format(time.RFC1123Z))
+
+	if err := sendSMTPMessage(client, config.EmailNoReply, recipient, message); err != nil {
+		fmt.Printf("Failed to send test email: %v\n", err)
+		return
+	}
+	fmt.Printf("Test email sent to %s.\n", recipient)
+}
+
+func sendSMTPMessage(client *smtp.Client, from string, to string, message string) error {
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	encryptionKeyPath = "config/encryption.pem"
+	privateConfigPath = "config/privateConfig.yml"
+	brandingDir       = "config/branding"
+	brandingWebPath   = "/branding"
+)
+
+// collectEnterpriseInput asks for the optional Enterprise edition branding.
+func collectEnterpriseInput(reader *bufio.Reader, config *Config) {
+	fmt.Println("\n=== Enterprise Configuration ===")
+	fmt.Println("The Enterprise Edition is licensed under the Fossorial Commercial License. License keys are activated from the dashboard after installation.")
+
+	config.EnableBranding = readBoolFlag(reader, "branding", "Would you like to customize the branding of the dashboard?", false)
+	if !config.EnableBranding {
+		return
+	}
+
+	config.BrandingAppName = readStringFlag(reader, "branding-app-name", "Enter the application name shown in the dashboard", "Pangolin")
+	config.BrandingPrimaryColorLight = readStringFlag(reader, "branding-primary-color", "Enter the primary color for the light theme as any CSS color (leave empty for the default)", "")
+	config.BrandingPrimaryColorDark = readStringFlag(reader, "branding-primary-color-dark", "Enter the primary color for the dark theme (leave empty for the default)", config.BrandingPrimaryColorLight)
+
+	config.BrandingLogoLightFile = readLogoFile(reader, "branding-logo-light", "Enter the path to the logo for the light theme (leave empty for the default)")
+	config.BrandingLogoDarkFile = readLogoFile(reader, "branding-logo-dark", "Enter the path to the logo for the dark theme (leave empty to use the light logo)")
+	if config.BrandingLogoDarkFile == "" {
+		config.BrandingLogoDarkFile = config.BrandingLogoLightFile
+	}
+
+	if config.BrandingLogoLightFile != "" {
+		config.BrandingLogoLightPath = brandingWebPath + "/logo-light" + filepath.Ext(config.BrandingLogoLightFile)
+	}
+	if config.BrandingLogoDarkFile != "" {
+		config.BrandingLogoDarkPath = brandingWebPath + "/logo-dark" + filepath.Ext(config.BrandingLogoDarkFile)
+	}
+}
+
+// readLogoFile reads the path of a logo file and makes sure it exists.
+func readLogoFile(reader *bufio.Reader, name string, prompt string) string {
+	for {
+		path := readStringFlag(reader, name, prompt, "")
+		if path == "" {
+			return ""
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		fmt.Printf("Logo file %s does not exist.\n", path)
+		if flagIsSet(name) {
+			os.Exit(1)
+		}
+	}
+}
+
+// setupEnterprise creates the files the Enterprise edition needs next to
+// the rendered configuration: the encryption key and the branding logos.
+func setupEnterprise(config Config) error {
+	if err := generateEncryptionKey(encryptionKeyPath); err != nil {
+		return err
+	}
+
+	if config.BrandingLogoLightFile == "" && config.BrandingLogoDarkFile == "" {
+		return nil
+	}
+
+	if err := mkdirAll(brandingDir, 0755); err != nil {
+		return fmt.Errorf("failed to create branding directory: %v", err)
+	}
+	if config.BrandingLogoLightFile != "" {
+		if err := copyFile(config.BrandingLogoLightFile, filepath.Join("config", config.BrandingLogoLightPath)); err != nil {
+			return fmt.Errorf("failed to copy light logo: %v", err)
+		}
+	}
+	if config.BrandingLogoDarkFile != "" {
+		if err := copyFile(config.BrandingLogoDarkFile, filepath.Join("config", config.BrandingLogoDarkPath)); err != nil {
+			return fmt.Errorf("failed to copy dark logo: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// generateEncryptionKey writes a random 256-bit hex encoded key used by the
+// Enterprise edition to encrypt certificates at rest. An existing key is
+// never replaced because data encrypted with it would become unreadable.
+func generateEncryptionKey(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		fmt.Println("Encryption key already exists, keeping it.")
+		return nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate encryption key: %v", err)
+	}
+
+	if isDryRun() {
+		return writeHiddenFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create encryption key file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		return fmt.Errorf("failed to write encryption key: %v", err)
+	}
+
+	if err := chownToSecretsOwner(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated encryption key at %s\n", path)
+	return nil
+}
+
+// detectEdition reports whether the compose file runs the Enterprise image.
+func detectEdition(composePath string) (bool, error) {
+	compose, err := loadComposeFile(composePath)
+	if err != nil {
+		return false, fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	_, tag, ok := strings.Cut(compose.Services["pangolin"].Image, "fosrl/pangolin:")
+	if !ok {
+		return false, fmt.Errorf("pangolin image not found in %s", composePath)
+	}
+
+	return strings.HasPrefix(tag, "ee-"), nil
+}
+
+// setEdition rewrites the pangolin image tag in the compose file to the
+// Enterprise or open source variant, leaving the rest of the file untouched.
+func setEdition(composePath string, enterprise bool) error {
+	compose, err := loadComposeFile(composePath)
+	if err != nil {
+		return fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	repository, tag, ok := strings.Cut(compose.Services["pangolin"].Image, "fosrl/pangolin:")
+	if !ok {
+		return fmt.Errorf("pangolin image not found in %s", composePath)
+	}
+	tag = strings.TrimPrefix(tag, "ee-")
+	if enterprise {
+		tag = "ee-" + tag
+	}
+
+	if err := compose.setImage("pangolin", repository+"fosrl/pangolin:"+tag); err != nil {
+		return err
+	}
+	if err := compose.save(); err != nil {
+		return fmt.Errorf("error writing compose file: %w", err)
+	}
+
+	return nil
+}
+
+// switchEdition moves an existing install between the open source and the
+// Enterprise images and recreates the pangolin container.
+func switchEdition(args []string) error {
+	if len(args) != 1 || (args[0] != "ee" && args[0] != "oss") {
+		return fmt.Errorf("usage: installer edition <ee|oss>")
+	}
+	enterprise := args[0] == "ee"
+
+	current, err := detectEdition("docker-compose.yml")
+	if err != nil {
+		return err
+	}
+	if current == enterprise {
+		fmt.Printf("Pangolin is already running the %s edition.\n", strings.ToUpper(args[0]))
+		return nil
+	}
+
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+
+	if enterprise {
+		if err := generateEncryptionKey(encryptionKeyPath); err != nil {
+			return err
+		}
+		if _, err := os.Stat(privateConfigPath); err != nil {
+			if err := renderConfigFile(privateConfigPath, Config{IsEnterprise: true, Vars: templateVars}); err != nil {
+				return err
+			}
+			if err := saveTemplateBaseline([]string{privateConfigPath}); err != nil {
+				return fmt.Errorf("error recording the template baseline: %v", err)
+			}
+		}
+	}
+
+	if err := setEdition("docker-compose.yml", enterprise); err != nil {
+		return err
+	}
+
+	containerType := detectContainerType()
+	if err := pullContainers(containerType); err != nil {
+		return err
+	}
+	if err := startContainers(containerType); err != nil {
+		return err
+	}
+
+	fmt.Printf("Switched Pangolin to the %s edition.\n", strings.ToUpper(args[0]))
+	if enterprise {
+		fmt.Println("Activate your license key from the dashboard to unlock the Enterprise features.")
+	}
+	return nil
+}
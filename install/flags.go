@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Command-line flags let the installer run without prompting. Every flag is
+// optional; when a flag is not supplied the installer falls back to asking
+// the question interactively.
+var (
+	flagRedis         = flag.String("redis", "", "Redis for Enterprise installs: bundled, external or none")
+	flagRedisHost     = flag.String("redis-host", "", "Host of an external Redis server")
+	flagRedisPort     = flag.Int("redis-port", 6379, "Port of an external Redis server")
+	flagRedisPassword = flag.String("redis-password", "", "Password of an external Redis server")
+	flagRedisDB       = flag.Int("redis-db", 0, "Redis database number")
+	flagRedisReplicas = flag.String("redis-replicas", "", "Comma separated host:port list of external Redis read replicas")
+
+	flagBranding                 = flag.Bool("branding", false, "Customize the branding of Enterprise installs")
+	flagBrandingAppName          = flag.String("branding-app-name", "", "Application name shown in the dashboard")
+	flagBrandingPrimaryColor     = flag.String("branding-primary-color", "", "Primary color of the light theme")
+	flagBrandingPrimaryColorDark = flag.String("branding-primary-color-dark", "", "Primary color of the dark theme")
+	flagBrandingLogoLight        = flag.String("branding-logo-light", "", "Path to the logo file for the light theme")
+	flagBrandingLogoDark         = flag.String("branding-logo-dark", "", "Path to the logo file for the dark theme")
+)
+
+// reviewing is set while an answer is changed on the review screen, so the
+// questions are asked again even when a flag supplied the first answer.
+var reviewing bool
+
+// flagIsSet reports whether the named flag was supplied on the command line.
+func flagIsSet(name string) bool {
+	if reviewing {
+		return false
+	}
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// readStringFlag returns the value of the named flag if it was supplied,
+// otherwise it prompts for the value.
+func readStringFlag(reader *bufio.Reader, name string, prompt string, defaultValue string) string {
+	if flagIsSet(name) {
+		return flag.Lookup(name).Value.String()
+	}
+	value, _ := readString(reader, prompt, defaultValue)
+	return value
+}
+
+// readValidatedStringFlag is readStringFlag for values that must pass
+// validate. Invalid answers are asked again; an invalid flag exits.
+func readValidatedStringFlag(reader *bufio.Reader, name string, prompt string, defaultValue string, validate func(string) error) string {
+	if !flagIsSet(name) {
+		return readValidatedString(reader, prompt, defaultValue, validate)
+	}
+	value := flag.Lookup(name).Value.String()
+	if err := validate(value); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return value
+}
+
+// readIntFlag returns the value of the named flag if it was supplied,
+// otherwise it prompts for the value.
+func readIntFlag(reader *bufio.Reader, name string, prompt string, defaultValue int) int {
+	if flagIsSet(name) {
+		if value, err := strconv.Atoi(flag.Lookup(name).Value.String()); err == nil {
+			return value
+		}
+	}
+	return readInt(reader, prompt, defaultValue)
+}
+
+// readPortFlag is readIntFlag for port numbers. Ports out of range are
+// asked again; an invalid flag exits.
+func readPortFlag(reader *bufio.Reader, name string, prompt string, defaultValue int) int {
+	for {
+		port := readIntFlag(reader, name, prompt, defaultValue)
+		err := validatePort(port)
+		if err == nil {
+			return port
+		}
+		fmt.Printf("Error: %v\n", err)
+		if flagIsSet(name) {
+			os.Exit(1)
+		}
+	}
+}
+
+// readBoolFlag returns the value of the named flag if it was supplied,
+// otherwise it prompts for the value.
+func readBoolFlag(reader *bufio.Reader, name string, prompt string, defaultValue bool) bool {
+	if flagIsSet(name) {
+		if value, err := strconv.ParseBool(flag.Lookup(name).Value.String()); err == nil {
+			return value
+		}
+	}
+	return readBool(reader, prompt, defaultValue)
+}
+
+// readPasswordFlag returns the value of the named flag if it was supplied,
+// otherwise it prompts for the value without echo.
+func readPasswordFlag(reader *bufio.Reader, name string, prompt string) string {
+	if flagIsSet(name) {
+		return flag.Lookup(name).Value.String()
+	}
+	return readPassword(prompt, reader)
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	maxmindDownloadURL = "https://download.maxmind.com/geoip/databases/%s/download?suffix=%s"
+	maxmindMirrorURL   = "https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/%s.tar.gz"
+
+	geoipCountryEdition = "GeoLite2-Country"
+	geoipASNEdition     = "GeoLite2-ASN"
+)
+
+var (
+	flagMaxMindAccountID     = flag.String("maxmind-account-id", "", "MaxMind account ID for the official GeoLite2 download (env MAXMIND_ACCOUNT_ID)")
+	flagMaxMindLicenseKey    = flag.String("maxmind-license-key", "", "MaxMind license key for the official GeoLite2 download (env MAXMIND_LICENSE_KEY)")
+	flagGeoIPASN             = flag.Bool("geoip-asn", false, "Also download the GeoLite2 ASN database")
+	flagGeoIPRequireChecksum = flag.Bool("geoip-require-checksum", false, "Refuse GeoLite2 downloads from the mirror when it publishes no checksum, as is always done with MaxMind credentials")
+)
+
+// metadataMarker starts the metadata section at the end of every MaxMind DB file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errNotFound is returned by httpGet when the server answers 404.
+var errNotFound = errors.New("not found")
+
+// errChecksum is returned when a MaxMind download does not match its
+// checksum, which is never retried from the mirror.
+var errChecksum = errors.New("checksum verification failed")
+
+// MaxMindCredentials authenticate against MaxMind's official download
+// endpoint. Without them the databases are fetched from a public mirror.
+type MaxMindCredentials struct {
+	AccountID  string
+	LicenseKey string
+}
+
+func (c MaxMindCredentials) valid() bool {
+	return c.AccountID != "" && c.LicenseKey != ""
+}
+
+// collectGeoIPInput asks which GeoLite2 databases to download and how.
+func collectGeoIPInput(reader *bufio.Reader, config *Config, defaultValue bool) {
+	config.EnableGeoblocking = readBool(reader, "Do you want to download the MaxMind GeoLite2 database for geoblocking functionality?", defaultValue)
+	config.EnableASN = false
+	config.MaxMind = MaxMindCredentials{}
+	if config.EnableGeoblocking {
+		config.EnableASN = readBoolFlag(reader, "geoip-asn", "Do you also want the GeoLite2 ASN database for rules based on the network operator (e.g. blocking hosting providers)?", false)
+		config.MaxMind = collectMaxMindInput(reader)
+	}
+}
+
+// collectMaxMindInput asks for optional MaxMind credentials. Flags and the
+// MAXMIND_ACCOUNT_ID / MAXMIND_LICENSE_KEY environment variables skip the
+// questions.
+func collectMaxMindInput(reader *bufio.Reader) MaxMindCredentials {
+	creds := maxMindCredentialsFromEnv()
+	if creds.valid() {
+		return creds
+	}
+
+	if !readBool(reader, "Do you have a MaxMind account to download GeoLite2 from MaxMind directly? Otherwise a public mirror is used", false) {
+		return creds
+	}
+
+	creds.AccountID = readStringFlag(reader, "maxmind-account-id", "Enter your MaxMind account ID", "")
+	creds.LicenseKey = readPasswordFlag(reader, "maxmind-license-key", "Enter your MaxMind license key")
+	return creds
+}
+
+// maxMindCredentialsFromEnv reads the MaxMind credentials from the flags,
+// falling back to the environment and then to the credentials stored for
+// scheduled updates.
+func maxMindCredentialsFromEnv() MaxMindCredentials {
+	creds := MaxMindCredentials{
+		AccountID:  *flagMaxMindAccountID,
+		LicenseKey: *flagMaxMindLicenseKey,
+	}
+	if creds.AccountID == "" {
+		creds.AccountID = os.Getenv("MAXMIND_ACCOUNT_ID")
+	}
+	if creds.LicenseKey == "" {
+		creds.LicenseKey = os.Getenv("MAXMIND_LICENSE_KEY")
+	}
+	if !creds.valid() {
+		if values, err := readEnvFile(maxmindCredentialsFile); err == nil {
+			creds.AccountID = values["MAXMIND_ACCOUNT_ID"]
+			creds.LicenseKey = values["MAXMIND_LICENSE_KEY"]
+		}
+	}
+	return creds
+}
+
+func downloadMaxMindDatabase(creds MaxMindCredentials) error {
+	return downloadGeoIPDatabase(geoipCountryEdition, creds)
+}
+
+// geoipDatabase describes a GeoLite2 database and the config.yml key that
+// points the server at it.
+type geoipDatabase struct {
+	edition   string
+	label     string
+	configKey string
+}
+
+var geoipDatabases = []geoipDatabase{
+	{edition: geoipCountryEdition, label: "Country", configKey: "maxmind_db_path"},
+	{edition: geoipASNEdition, label: "ASN", configKey: "maxmind_asn_path"},
+}
+
+func (db geoipDatabase) path() string {
+	return filepath.Join("config", db.edition+".mmdb")
+}
+
+// updateGeoIPDatabases offers to update the databases of an existing install
+// and to download the ones that are missing, enabling them in config.yml.
+func updateGeoIPDatabases(reader *bufio.Reader) {
+	fmt.Println("\n=== MaxMind Database Update ===")
+
+	var installed, missing []geoipDatabase
+	for _, db := range geoipDatabases {
+		if _, err := os.Stat(db.path()); err == nil {
+			fmt.Printf("MaxMind GeoLite2 %s database found.\n", db.label)
+			installed = append(installed, db)
+		} else {
+			fmt.Printf("MaxMind GeoLite2 %s database not found.\n", db.label)
+			missing = append(missing, db)
+		}
+	}
+
+	var creds *MaxMindCredentials
+	enabled := false
+	credentials := func() MaxMindCredentials {
+		if creds == nil {
+			c := collectMaxMindInput(reader)
+			creds = &c
+		}
+		return *creds
+	}
+
+	if len(installed) > 0 && readBool(reader, "Would you like to update the MaxMind databases to the latest version?", false) {
+		for _, db := range installed {
+			if err := downloadGeoIPDatabase(db.edition, credentials()); err != nil {
+				fmt.Printf("Error updating MaxMind %s database: %v\n", db.label, err)
+				fmt.Println("You can try updating it manually later if needed.")
+			}
+		}
+	}
+
+	for _, db := range missing {
+		prompt := "Would you like to download the MaxMind GeoLite2 database for geoblocking functionality?"
+		if db.edition == geoipASNEdition {
+			prompt = "Would you like to download the MaxMind GeoLite2 ASN database for ASN-based rules?"
+		}
+		if !readBool(reader, prompt, false) {
+			continue
+		}
+
+		if err := downloadGeoIPDatabase(db.edition, credentials()); err != nil {
+			fmt.Printf("Error downloading MaxMind %s database: %v\n", db.label, err)
+			fmt.Println("You can try downloading it manually later if needed.")
+			continue
+		}
+
+		if err := enableGeoIPDatabase(db); err != nil {
+			fmt.Printf("Error enabling MaxMind %s database: %v\n", db.label, err)
+			fmt.Println("Add the following line under the 'server' section of config/config.yml:")
+			fmt.Printf("  %s: \"./%s\"\n", db.configKey, filepath.ToSlash(db.path()))
+			continue
+		}
+		enabled = true
+	}
+
+	// The server only reads the database paths on startup
+	if enabled {
+		containerType := detectContainerType()
+		if isContainerRunning("pangolin", containerType) {
+			if err := restartContainer("pangolin", containerType); err != nil {
+				fmt.Printf("Error restarting Pangolin: %v\n", err)
+				fmt.Println("Restart it manually to load the new configuration.")
+			}
+		}
+	}
+
+	for _, db := range geoipDatabases {
+		if _, err := os.Stat(db.path()); err == nil {
+			if creds == nil {
+				offerGeoIPAutoUpdate(reader, maxMindCredentialsFromEnv())
+			} else {
+				offerGeoIPAutoUpdate(reader, *creds)
+			}
+			return
+		}
+	}
+}
+
+// enableGeoIPDatabase points config.yml at a downloaded database.
+func enableGeoIPDatabase(db geoipDatabase) error {
+	value := "./" + filepath.ToSlash(db.path())
+	if err := SetYAMLValue("config/config.yml", value, "server", db.configKey); err != nil {
+		return err
+	}
+	fmt.Printf("Set server.%s to %q in config/config.yml.\n", db.configKey, value)
+	return nil
+}
+
+// downloadGeoIPDatabase downloads a GeoLite2 edition, verifies its checksum,
+// extracts the .mmdb and atomically replaces config/<edition>.mmdb. The
+// official MaxMind endpoint is used when credentials are available, with the
+// public mirror as a fallback when it cannot be reached. That fallback has to
+// publish a checksum as well.
+func downloadGeoIPDatabase(edition string, creds MaxMindCredentials) error {
+	if creds.valid() {
+		if dryRunDownload(fmt.Sprintf(maxmindDownloadURL, edition, "tar.gz")) {
+			return nil
+		}
+	} else if dryRunDownload(fmt.Sprintf(maxmindMirrorURL, edition)) {
+		return nil
+	}
+
+	fmt.Printf("Downloading MaxMind %s database...\n", edition)
+
+	var archive []byte
+	var err error
+	if creds.valid() {
+		archive, err = downloadFromMaxMind(edition, creds)
+		if errors.Is(err, errChecksum) {
+			return err
+		}
+		if err != nil {
+			fmt.Printf("Warning: download from MaxMind failed: %v\n", err)
+			fmt.Println("Falling back to the public mirror...")
+		}
+	}
+	if archive == nil {
+		archive, err = downloadFromMirror(edition, *flagGeoIPRequireChecksum || creds.valid())
+		if err != nil {
+			return err
+		}
+	}
+
+	database, err := extractMMDB(archive, edition+".mmdb")
+	if err != nil {
+		return fmt.Errorf("failed to extract %s database: %v", edition, err)
+	}
+	if !bytes.Contains(database[max(0, len(database)-128*1024):], metadataMarker) {
+		return fmt.Errorf("downloaded %s database is not a valid MaxMind DB file", edition)
+	}
+
+	if err := replaceFileAtomically(filepath.Join("config", edition+".mmdb"), database, 0644); err != nil {
+		return fmt.Errorf("failed to install %s database: %v", edition, err)
+	}
+
+	fmt.Printf("MaxMind %s database downloaded successfully!\n", edition)
+	return nil
+}
+
+// downloadFromMaxMind fetches an edition from the official endpoint. The
+// checksum is always published there and must match.
+func downloadFromMaxMind(edition string, creds MaxMindCredentials) ([]byte, error) {
+	archive, err := httpGet(fmt.Sprintf(maxmindDownloadURL, edition, "tar.gz"), creds)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := httpGet(fmt.Sprintf(maxmindDownloadURL, edition, "tar.gz.sha256"), creds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download checksum: %v", err)
+	}
+	if err := verifySHA256(archive, checksum); err != nil {
+		return nil, fmt.Errorf("%w: %v", errChecksum, err)
+	}
+
+	return archive, nil
+}
+
+// downloadFromMirror fetches an edition from the public mirror and verifies
+// it against the mirror's checksum file when one is published. With
+// requireChecksum a missing checksum file fails the download.
+func downloadFromMirror(edition string, requireChecksum bool) ([]byte, error) {
+	url := fmt.Sprintf(maxmindMirrorURL, edition)
+
+	archive, err := httpGet(url, MaxMindCredentials{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s database: %v", edition, err)
+	}
+
+	checksum, err := httpGet(url+".sha256", MaxMindCredentials{})
+	if errors.Is(err, errNotFound) {
+		if requireChecksum {
+			return nil, fmt.Errorf("the mirror publishes no checksum for %s", edition)
+		}
+		fmt.Printf("Warning: the mirror publishes no checksum for %s, only the file format is verified.\n", edition)
+		return archive, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download checksum: %v", err)
+	}
+	if err := verifySHA256(archive, checksum); err != nil {
+		return nil, err
+	}
+
+	return archive, nil
+}
+
+// httpGet downloads url, authenticating with the MaxMind credentials when
+// they are set. A 404 is reported as errNotFound so a missing checksum file
+// can be told apart from a failed download.
+func httpGet(url string, creds MaxMindCredentials) ([]byte, error) {
+	client := &http.Client{
+		Timeout: 5 * time.Minute,
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if creds.valid() {
+		req.SetBasicAuth(creds.AccountID, creds.LicenseKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// verifySHA256 compares data against a sha256sum style checksum file.
+func verifySHA256(data []byte, checksumFile []byte) error {
+	fields := strings.Fields(string(checksumFile))
+	if len(fields) == 0 {
+		return fmt.Errorf("checksum file is empty")
+	}
+
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(fields[0], hex.EncodeToString(sum[:])) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", fields[0], hex.EncodeToString(sum[:]))
+	}
+
+	return nil
+}
+
+// extractMMDB returns the contents of the named file from a .tar.gz archive,
+// wherever it is located inside the archive.
+func extractMMDB(archive []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// replaceFileAtomically writes data next to dst and renames it into place,
+// so readers never see a partially written file.
+func replaceFileAtomically(dst string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
+}
@@ -3,24 +3,50 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"net/mail"
+	"os"
 	"strings"
 	"syscall"
 
 	"golang.org/x/term"
 )
 
-func readString(reader *bufio.Reader, prompt string, defaultValue string) string {
+// readString prompts for a value. The error is the one of reading the
+// answer, io.EOF once the input has ended.
+func readString(reader *bufio.Reader, prompt string, defaultValue string) (string, error) {
 	if defaultValue != "" {
 		fmt.Printf("%s (default: %s): ", prompt, defaultValue)
 	} else {
 		fmt.Print(prompt + ": ")
 	}
-	input, _ := reader.ReadString('\n')
+	input, err := reader.ReadString('\n')
 	input = strings.TrimSpace(input)
 	if input == "" {
-		return defaultValue
+		return defaultValue, err
+	}
+	return input, err
+}
+
+// readValidatedString asks again until the answer passes validate.
+func readValidatedString(reader *bufio.Reader, prompt string, defaultValue string, validate func(string) error) string {
+	for {
+		value, readErr := readString(reader, prompt, defaultValue)
+		err := validate(value)
+		if err == nil {
+			return value
+		}
+		fmt.Printf("Error: %v\n", err)
+		exitAtEOF(readErr)
+	}
+}
+
+// exitAtEOF exits when the input has ended, as an answer that failed
+// validation cannot be fixed then.
+func exitAtEOF(err error) {
+	if err == io.EOF {
+		os.Exit(1)
 	}
-	return input
 }
 
 func readStringNoDefault(reader *bufio.Reader, prompt string) string {
@@ -45,7 +71,8 @@ func readPassword(prompt string, reader *bufio.Reader) string {
 		return input
 	} else {
 		// Fallback to reading from stdin if not in a terminal
-		return readString(reader, prompt, "")
+		input, _ := readString(reader, prompt, "")
+		return input
 	}
 }
 
@@ -55,7 +82,7 @@ func readBool(reader *bufio.Reader, prompt string, defaultValue bool) bool {
 		defaultStr = "yes"
 	}
 	for {
-		input := readString(reader, prompt+" (yes/no)", defaultStr)
+		input, _ := readString(reader, prompt+" (yes/no)", defaultStr)
 		lower := strings.ToLower(input)
 		if lower == "yes" {
 			return true
@@ -82,7 +109,7 @@ func readBoolNoDefault(reader *bufio.Reader, prompt string) bool {
 }
 
 func readInt(reader *bufio.Reader, prompt string, defaultValue int) int {
-	input := readString(reader, prompt, fmt.Sprintf("%d", defaultValue))
+	input, _ := readString(reader, prompt, fmt.Sprintf("%d", defaultValue))
 	if input == "" {
 		return defaultValue
 	}
@@ -90,3 +117,37 @@ func readInt(reader *bufio.Reader, prompt string, defaultValue int) int {
 	fmt.Sscanf(input, "%d", &value)
 	return value
 }
+
+func validateRequired(value string) error {
+	if value == "" {
+		return fmt.Errorf("a value is required")
+	}
+	return nil
+}
+
+func validateDomain(value string) error {
+	if value == "" {
+		return fmt.Errorf("a domain name is required")
+	}
+	if !isDomainName(strings.ToLower(value)) {
+		return fmt.Errorf("%q is not a valid domain name", value)
+	}
+	return nil
+}
+
+func validateEmail(value string) error {
+	if value == "" {
+		return fmt.Errorf("an email address is required")
+	}
+	if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+		return fmt.Errorf("%q is not a valid email address", value)
+	}
+	return nil
+}
+
+func validatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port %d is out of range 1-65535", port)
+	}
+	return nil
+}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"embed"
+	"flag"
 	"fmt"
 	"io"
 	"io/fs"
-	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -17,6 +18,8 @@ import (
 	"strings"
 	"text/template"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // DO NOT EDIT THIS FUNCTION; IT MATCHED BY REGEX IN CICD
@@ -30,26 +33,54 @@ func loadVersions(config *Config) {
 var configFiles embed.FS
 
 type Config struct {
-	InstallationContainerType SupportedContainer
-	PangolinVersion           string
-	GerbilVersion             string
-	BadgerVersion             string
-	BaseDomain                string
-	DashboardDomain           string
-	EnableIPv6                bool
-	LetsEncryptEmail          string
-	EnableEmail               bool
-	EmailSMTPHost             string
-	EmailSMTPPort             int
-	EmailSMTPUser             string
-	EmailSMTPPass             string
-	EmailNoReply              string
-	InstallGerbil             bool
-	TraefikBouncerKey         string
-	DoCrowdsecInstall         bool
-	EnableGeoblocking         bool
-	Secret                    string
-	IsEnterprise              bool
+	InstallationContainerType      SupportedContainer
+	PangolinVersion                string
+	GerbilVersion                  string
+	BadgerVersion                  string
+	BaseDomains                    []BaseDomain
+	DashboardDomain                string
+	EnableIPv6                     bool
+	LetsEncryptEmail               string
+	EnableEmail                    bool
+	EmailSMTPHost                  string
+	EmailSMTPPort                  int
+	EmailSMTPUser                  string
+	EmailSMTPPass                  string
+	EmailSMTPSecure                bool
+	EmailSMTPTLSRejectUnauthorized bool
+	EmailNoReply                   string
+	InstallGerbil                  bool
+	TraefikBouncerKey              string
+	DoCrowdsecInstall              bool
+	CrowdsecTrustedProxies         []string
+	CrowdsecTrustedClients         []string
+	CrowdsecForwardedTrustedIPs    []string
+	CrowdsecClientTrustedIPs       []string
+	CrowdsecCaptchaProvider        string
+	CrowdsecCaptchaSiteKey         string
+	CrowdsecCaptchaSecretKey       string
+	EnableGeoblocking              bool
+	EnableASN                      bool
+	MaxMind                        MaxMindCredentials
+	Secret                         string
+	IsEnterprise                   bool
+	SecretsMode                    string
+	EnableRedis                    bool
+	InstallRedis                   bool
+	RedisHost                      string
+	RedisPort                      int
+	RedisPassword                  string
+	RedisDB                        int
+	RedisReplicas                  []RedisNode
+	EnableBranding                 bool
+	BrandingAppName                string
+	BrandingPrimaryColorLight      string
+	BrandingPrimaryColorDark       string
+	BrandingLogoLightFile          string
+	BrandingLogoDarkFile           string
+	BrandingLogoLightPath          string
+	BrandingLogoDarkPath           string
+	Vars                           map[string]interface{}
 }
 
 type SupportedContainer string
@@ -61,6 +92,25 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	flag.Parse()
+
+	if err := validateSecretFlags(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := loadTemplateOverrides(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// print a banner about prerequisites - opening port 80, 443, 51820, and 21820 on the VPS and firewall and pointing your domain to the VPS IP with a records. Docs are at http://localhost:3000/Getting%20Started/dns-networking
 
@@ -86,13 +136,54 @@ func main() {
 	var config Config
 	var alreadyInstalled = false
 
-	// check if there is already a config file
-	if _, err := os.Stat("config/config.yml"); err != nil {
+	if isDryRun() {
+		fmt.Println("\nDry run: nothing will be changed, the planned changes are printed at the end.")
+		defer func() { printDryRunPlan(config) }()
+	}
+
+	state, err := loadInstallState()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// check if there is already a config file, and whether the install that wrote it finished
+	if state == nil && !fileExists("config/config.yml") {
 		config = collectUserInput(reader)
 
 		loadVersions(&config)
-		config.DoCrowdsecInstall = false
+
+		if state, err = newInstallState(config); err != nil {
+			fmt.Printf("Error saving the install state: %v\n", err)
+			os.Exit(1)
+		}
+	} else if state != nil && !state.done(stepComplete) {
+		fmt.Printf("\nResuming the installation that stopped while %s.\n", installStepDescriptions[state.next()])
+		config = state.Config
+	} else {
+		state = nil
+		alreadyInstalled = true
+		fmt.Println("Looks like you already installed Pangolin!")
+
+		// Check if the MaxMind databases exist and offer to update them
+		updateGeoIPDatabases(reader)
+	}
+
+	if state != nil && !state.done(stepConfig) {
+		// Secrets are not kept in the state, so a resumed install generates them again
 		config.Secret = generateRandomSecretKey()
+		if config.InstallRedis && config.RedisPassword == "" {
+			config.RedisPassword = generateRandomSecretKey()
+		}
+		if config.EnableRedis && !config.InstallRedis && config.RedisPassword == "" && state.RedisPasswordSet {
+			config.RedisPassword = readPasswordFlag(reader, "redis-password", "Enter the Redis password")
+		}
+		if config.EnableEmail && config.EmailSMTPPass == "" {
+			config.EmailSMTPPass = readPassword("Enter SMTP password", reader)
+		}
+		if config.DoCrowdsecInstall && config.CrowdsecCaptchaProvider != "" && config.CrowdsecCaptchaSecretKey == "" {
+			config.CrowdsecCaptchaSecretKey = readPassword("Enter the "+config.CrowdsecCaptchaProvider+" secret key", reader)
+		}
 
 		fmt.Println("\n=== Generating Configuration Files ===")
 
@@ -103,22 +194,64 @@ func main() {
 
 		moveFile("config/docker-compose.yml", "docker-compose.yml")
 
+		if err := writeSecretFiles(config); err != nil {
+			fmt.Printf("Error writing secrets: %v\n", err)
+			os.Exit(1)
+		}
+
+		if config.IsEnterprise {
+			if err := setupEnterprise(config); err != nil {
+				fmt.Printf("Error setting up the Enterprise edition: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		fmt.Println("\nConfiguration files created successfully!")
+		completeInstallStep(state, stepConfig)
+	}
 
-		// Download MaxMind database if requested
+	if state != nil && !state.done(stepGeoIP) {
+		// Download MaxMind databases if requested
 		if config.EnableGeoblocking {
-			fmt.Println("\n=== Downloading MaxMind Database ===")
-			if err := downloadMaxMindDatabase(); err != nil {
+			if !config.MaxMind.valid() {
+				if creds := maxMindCredentialsFromEnv(); creds.valid() || config.MaxMind.AccountID == "" {
+					config.MaxMind = creds
+				} else {
+					// The license key is not kept in the install state
+					config.MaxMind.LicenseKey = readPasswordFlag(reader, "maxmind-license-key", "Enter your MaxMind license key")
+				}
+			}
+
+			fmt.Println("\n=== Downloading MaxMind Databases ===")
+			if err := downloadMaxMindDatabase(config.MaxMind); err != nil {
 				fmt.Printf("Error downloading MaxMind database: %v\n", err)
 				fmt.Println("You can download it manually later if needed.")
 			}
+			if config.EnableASN {
+				if err := downloadGeoIPDatabase(geoipASNEdition, config.MaxMind); err != nil {
+					fmt.Printf("Error downloading MaxMind ASN database: %v\n", err)
+					fmt.Println("You can download it manually later if needed.")
+				}
+			}
+			offerGeoIPAutoUpdate(reader, config.MaxMind)
+		}
+		completeInstallStep(state, stepGeoIP)
+	}
+
+	if state != nil && !state.done(stepContainers) {
+		// The server refuses to start with an invalid config, so don't start the containers either
+		configErr := validateInstallConfig()
+		if configErr != nil {
+			fmt.Printf("Error: %v\n", configErr)
+			fmt.Println("Fix the config and run the installer again to start the containers.")
 		}
 
 		fmt.Println("\n=== Starting installation ===")
 
-		if readBool(reader, "Would you like to install and start the containers?", true) {
+		if configErr == nil && readBool(reader, "Would you like to install and start the containers?", true) {
 
 			config.InstallationContainerType = podmanOrDocker(reader)
+			state.Config.InstallationContainerType = config.InstallationContainerType
 
 			if !isDockerInstalled() && runtime.GOOS == "linux" && config.InstallationContainerType == Docker {
 				if readBool(reader, "Docker is not installed. Would you like to install it?", true) {
@@ -130,20 +263,22 @@ func main() {
 						fmt.Println("Docker service started successfully!")
 					}
 					// wait 10 seconds for docker to start checking if docker is running every 2 seconds
-					fmt.Println("Waiting for Docker to start...")
-					for i := 0; i < 5; i++ {
-						if isDockerRunning() {
-							fmt.Println("Docker is running!")
-							break
+					if !isDryRun() {
+						fmt.Println("Waiting for Docker to start...")
+						for i := 0; i < 5; i++ {
+							if isDockerRunning() {
+								fmt.Println("Docker is running!")
+								break
+							}
+							fmt.Println("Docker is not running yet, waiting...")
+							time.Sleep(2 * time.Second)
 						}
-						fmt.Println("Docker is not running yet, waiting...")
-						time.Sleep(2 * time.Second)
-					}
-					if !isDockerRunning() {
-						fmt.Println("Docker is still not running after 10 seconds. Please check the installation.")
-						os.Exit(1)
+						if !isDockerRunning() {
+							fmt.Println("Docker is still not running after 10 seconds. Please check the installation.")
+							os.Exit(1)
+						}
+						fmt.Println("Docker installed successfully!")
 					}
-					fmt.Println("Docker installed successfully!")
 				}
 			}
 
@@ -152,94 +287,78 @@ func main() {
 				return
 			}
 
+			if config.DoCrowdsecInstall {
+				if err := provisionCrowdsecBouncer(config); err != nil {
+					fmt.Println("Error: ", err)
+					return
+				}
+			}
+
 			if err := startContainers(config.InstallationContainerType); err != nil {
 				fmt.Println("Error: ", err)
 				return
 			}
 		}
 
-	} else {
-		alreadyInstalled = true
-		fmt.Println("Looks like you already installed Pangolin!")
+		if config.DoCrowdsecInstall && checkIfTextInFile("config/traefik/dynamic_config.yml", bouncerKeyPlaceholder) {
+			fmt.Println("The CrowdSec bouncer is not registered yet. Once the containers run, add it and replace the placeholder in config/traefik/dynamic_config.yml with its key:")
+			fmt.Println("	docker exec crowdsec cscli bouncers add traefik-bouncer")
+		}
 
-		// Check if MaxMind database exists and offer to update it
-		fmt.Println("\n=== MaxMind Database Update ===")
-		if _, err := os.Stat("config/GeoLite2-Country.mmdb"); err == nil {
-			fmt.Println("MaxMind GeoLite2 Country database found.")
-			if readBool(reader, "Would you like to update the MaxMind database to the latest version?", false) {
-				if err := downloadMaxMindDatabase(); err != nil {
-					fmt.Printf("Error updating MaxMind database: %v\n", err)
-					fmt.Println("You can try updating it manually later if needed.")
-				}
-			}
-		} else {
-			fmt.Println("MaxMind GeoLite2 Country database not found.")
-			if readBool(reader, "Would you like to download the MaxMind GeoLite2 database for geoblocking functionality?", false) {
-				if err := downloadMaxMindDatabase(); err != nil {
-					fmt.Printf("Error downloading MaxMind database: %v\n", err)
-					fmt.Println("You can try downloading it manually later if needed.")
-				}
-				// Now you need to update your config file accordingly to enable geoblocking
-				fmt.Print("Please remember to update your config/config.yml file to enable geoblocking! \n\n")
-				// add   maxmind_db_path: "./config/GeoLite2-Country.mmdb" under server
-				fmt.Println("Add the following line under the 'server' section:")
-				fmt.Println("  maxmind_db_path: \"./config/GeoLite2-Country.mmdb\"")
-			}
+		// Declining to start the containers still finishes this step; an invalid config does not
+		if configErr == nil {
+			completeInstallStep(state, stepContainers)
 		}
 	}
 
-	if !checkIsCrowdsecInstalledInCompose() {
+	// New installs ask about CrowdSec with the other questions; this adds it to an existing install
+	if alreadyInstalled && !checkIsCrowdsecInstalledInCompose() {
 		fmt.Println("\n=== CrowdSec Install ===")
-		// check if crowdsec is installed
-		if readBool(reader, "Would you like to install CrowdSec?", false) {
-			fmt.Println("This installer constitutes a minimal viable CrowdSec deployment. CrowdSec will add extra complexity to your Pangolin installation and may not work to the best of its abilities out of the box. Users are expected to implement configuration adjustments on their own to achieve the best security posture. Consult the CrowdSec documentation for detailed configuration instructions.")
-
-			// BUG: crowdsec installation will be skipped if the user chooses to install on the first installation.
-			if readBool(reader, "Are you willing to manage CrowdSec?", false) {
-				if config.DashboardDomain == "" {
-					traefikConfig, err := ReadTraefikConfig("config/traefik/traefik_config.yml")
-					if err != nil {
-						fmt.Printf("Error reading config: %v\n", err)
-						return
-					}
-					appConfig, err := ReadAppConfig("config/config.yml")
-					if err != nil {
-						fmt.Printf("Error reading config: %v\n", err)
-						return
-					}
+		if collectCrowdsecInput(reader, &config); config.DoCrowdsecInstall {
+			if config.DashboardDomain == "" {
+				traefikConfig, err := ReadTraefikConfig("config/traefik/traefik_config.yml")
+				if err != nil {
+					fmt.Printf("Error reading config: %v\n", err)
+					return
+				}
+				appConfig, err := ReadAppConfig("config/config.yml")
+				if err != nil {
+					fmt.Printf("Error reading config: %v\n", err)
+					return
+				}
 
-					parsedURL, err := url.Parse(appConfig.DashboardURL)
-					if err != nil {
-						fmt.Printf("Error parsing URL: %v\n", err)
-						return
-					}
+				parsedURL, err := url.Parse(appConfig.DashboardURL)
+				if err != nil {
+					fmt.Printf("Error parsing URL: %v\n", err)
+					return
+				}
 
-					config.DashboardDomain = parsedURL.Hostname()
-					config.LetsEncryptEmail = traefikConfig.LetsEncryptEmail
-					config.BadgerVersion = traefikConfig.BadgerVersion
+				config.DashboardDomain = parsedURL.Hostname()
+				config.LetsEncryptEmail = traefikConfig.LetsEncryptEmail
+				config.BadgerVersion = traefikConfig.BadgerVersion
+				config.Vars = templateVars
 
-					// print the values and check if they are right
-					fmt.Println("Detected values:")
-					fmt.Printf("Dashboard Domain: %s\n", config.DashboardDomain)
-					fmt.Printf("Let's Encrypt Email: %s\n", config.LetsEncryptEmail)
-					fmt.Printf("Badger Version: %s\n", config.BadgerVersion)
+				// print the values and check if they are right
+				fmt.Println("Detected values:")
+				fmt.Printf("Dashboard Domain: %s\n", config.DashboardDomain)
+				fmt.Printf("Let's Encrypt Email: %s\n", config.LetsEncryptEmail)
+				fmt.Printf("Badger Version: %s\n", config.BadgerVersion)
 
-					if !readBool(reader, "Are these values correct?", true) {
-						config = collectUserInput(reader)
-					}
+				if !readBool(reader, "Are these values correct?", true) {
+					config = collectUserInput(reader)
 				}
+			}
 
-				config.InstallationContainerType = podmanOrDocker(reader)
-
-				config.DoCrowdsecInstall = true
-				err := installCrowdsec(config)
-				if err != nil {
-					fmt.Printf("Error installing CrowdSec: %v\n", err)
-					return
-				}
+			config.InstallationContainerType = podmanOrDocker(reader)
 
-				fmt.Println("CrowdSec installed successfully!")
+			config.DoCrowdsecInstall = true
+			err := installCrowdsec(config)
+			if err != nil {
+				fmt.Printf("Error installing CrowdSec: %v\n", err)
+				return
 			}
+
+			fmt.Println("CrowdSec installed successfully!")
 		}
 	}
 
@@ -262,13 +381,17 @@ func main() {
 		}
 	}
 
+	if state != nil {
+		completeInstallStep(state, stepComplete)
+	}
+
 	fmt.Println("\nInstallation complete!")
 
 	fmt.Printf("\nTo complete the initial setup, please visit:\nhttps://%s/auth/initial-setup\n", config.DashboardDomain)
 }
 
 func podmanOrDocker(reader *bufio.Reader) SupportedContainer {
-	inputContainer := readString(reader, "Would you like to run Pangolin as Docker or Podman containers?", "docker")
+	inputContainer, _ := readString(reader, "Would you like to run Pangolin as Docker or Podman containers?", "docker")
 
 	chosenContainer := Docker
 	if strings.EqualFold(inputContainer, "docker") {
@@ -335,48 +458,42 @@ func podmanOrDocker(reader *bufio.Reader) SupportedContainer {
 }
 
 func collectUserInput(reader *bufio.Reader) Config {
-	config := Config{}
+	if useTUI() {
+		config, err := runWizard(reader)
+		if err == nil {
+			return config
+		}
+		if err == errWizardAborted {
+			fmt.Println("Installation cancelled.")
+			os.Exit(1)
+		}
+		fmt.Printf("Error: %v\nFalling back to the plain prompts.\n", err)
+	}
+
+	config := Config{Vars: templateVars}
 
 	// Basic configuration
 	fmt.Println("\n=== Basic Configuration ===")
 
 	config.IsEnterprise = readBoolNoDefault(reader, "Do you want to install the Enterprise version of Pangolin? The EE is free for personal use or for businesses making less than 100k USD annually.")
 
-	config.BaseDomain = readString(reader, "Enter your base domain (no subdomain e.g. example.com)", "")
+	config.BaseDomains = collectBaseDomains(reader)
 
 	// Set default dashboard domain after base domain is collected
 	defaultDashboardDomain := ""
-	if config.BaseDomain != "" {
-		defaultDashboardDomain = "pangolin." + config.BaseDomain
+	if len(config.BaseDomains) > 0 {
+		defaultDashboardDomain = "pangolin." + config.BaseDomains[0].Domain
 	}
-	config.DashboardDomain = readString(reader, "Enter the domain for the Pangolin dashboard", defaultDashboardDomain)
-	config.LetsEncryptEmail = readString(reader, "Enter email for Let's Encrypt certificates", "")
+	config.DashboardDomain = readValidatedString(reader, "Enter the domain for the Pangolin dashboard", defaultDashboardDomain, validateDomain)
+	config.LetsEncryptEmail = readValidatedString(reader, "Enter email for Let's Encrypt certificates", "", validateEmail)
 	config.InstallGerbil = readBool(reader, "Do you want to use Gerbil to allow tunneled connections", true)
 
 	// Email configuration
-	fmt.Println("\n=== Email Configuration ===")
-	config.EnableEmail = readBool(reader, "Enable email functionality (SMTP)", false)
+	collectEmailInput(reader, &config)
 
-	if config.EnableEmail {
-		config.EmailSMTPHost = readString(reader, "Enter SMTP host", "")
-		config.EmailSMTPPort = readInt(reader, "Enter SMTP port (default 587)", 587)
-		config.EmailSMTPUser = readString(reader, "Enter SMTP username", "")
-		config.EmailSMTPPass = readString(reader, "Enter SMTP password", "") // Should this be readPassword?
-		config.EmailNoReply = readString(reader, "Enter no-reply email address (often the same as SMTP username)", "")
-	}
-
-	// Validate required fields
-	if config.BaseDomain == "" {
-		fmt.Println("Error: Domain name is required")
-		os.Exit(1)
-	}
-	if config.LetsEncryptEmail == "" {
-		fmt.Println("Error: Let's Encrypt email is required")
-		os.Exit(1)
-	}
-	if config.EnableEmail && config.EmailNoReply == "" {
-		fmt.Println("Error: No-reply email address is required when email is enabled")
-		os.Exit(1)
+	if config.IsEnterprise {
+		collectEnterpriseInput(reader, &config)
+		collectRedisInput(reader, &config)
 	}
 
 	// Advanced configuration
@@ -384,24 +501,55 @@ func collectUserInput(reader *bufio.Reader) Config {
 	fmt.Println("\n=== Advanced Configuration ===")
 
 	config.EnableIPv6 = readBool(reader, "Is your server IPv6 capable?", true)
-	config.EnableGeoblocking = readBool(reader, "Do you want to download the MaxMind GeoLite2 database for geoblocking functionality?", true)
+	collectGeoIPInput(reader, &config, true)
+	collectSecretsInput(reader, &config)
 
-	if config.DashboardDomain == "" {
-		fmt.Println("Error: Dashboard Domain name is required")
-		os.Exit(1)
-	}
+	fmt.Println("\n=== CrowdSec ===")
+	collectCrowdsecInput(reader, &config)
+
+	// Nothing is written until the answers are confirmed
+	reviewUserInput(reader, &config)
 
 	return config
 }
 
 func createConfigFiles(config Config) error {
-	os.MkdirAll("config", 0755)
-	os.MkdirAll("config/letsencrypt", 0755)
-	os.MkdirAll("config/db", 0755)
-	os.MkdirAll("config/logs", 0755)
+	mkdirAll("config", 0755)
+	mkdirAll("config/letsencrypt", 0755)
+	mkdirAll("config/db", 0755)
+	mkdirAll("config/logs", 0755)
+	if config.InstallRedis {
+		mkdirAll("config/redis", 0755)
+	}
+
+	if config.DoCrowdsecInstall {
+		setCrowdsecTrustedIPs(&config)
+	}
+
+	err := renderTemplateTree(config, func(path string) bool {
+		return config.DoCrowdsecInstall || !strings.Contains(path, "crowdsec")
+	})
+	if err != nil {
+		return err
+	}
+	if err := saveTemplateOverrides(); err != nil {
+		return fmt.Errorf("error recording the template overrides: %v", err)
+	}
+	if err := saveTemplateBaseline(installTemplates(config)); err != nil {
+		return fmt.Errorf("error recording the template baseline: %v", err)
+	}
+
+	// Fold the CrowdSec templates into the Traefik configs and compose file
+	if config.DoCrowdsecInstall {
+		return mergeCrowdsecConfigFiles("config/docker-compose.yml", config)
+	}
+	return nil
+}
 
-	// Walk through all embedded files
-	err := fs.WalkDir(configFiles, "config", func(path string, d fs.DirEntry, err error) error {
+// renderTemplateTree renders the templates for which include returns true.
+func renderTemplateTree(config Config, include func(path string) bool) error {
+	// Walk through all templates, embedded or from --templates
+	err := fs.WalkDir(templates, "config", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -411,11 +559,11 @@ func createConfigFiles(config Config) error {
 			return nil
 		}
 
-		if !config.DoCrowdsecInstall && strings.Contains(path, "crowdsec") {
+		if !include(path) {
 			return nil
 		}
 
-		if config.DoCrowdsecInstall && !strings.Contains(path, "crowdsec") {
+		if !config.IsEnterprise && path == "config/privateConfig.yml" {
 			return nil
 		}
 
@@ -426,51 +574,100 @@ func createConfigFiles(config Config) error {
 
 		if d.IsDir() {
 			// Create directory
-			if err := os.MkdirAll(path, 0755); err != nil {
+			if err := mkdirAll(path, 0755); err != nil {
 				return fmt.Errorf("failed to create directory %s: %v", path, err)
 			}
 			return nil
 		}
 
-		// Read the template file
-		content, err := configFiles.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to read %s: %v", path, err)
-		}
+		return renderConfigFile(path, config)
+	})
+	if err != nil {
+		return fmt.Errorf("error walking config files: %v", err)
+	}
 
-		// Parse template
-		tmpl, err := template.New(d.Name()).Parse(string(content))
-		if err != nil {
-			return fmt.Errorf("failed to parse template %s: %v", path, err)
-		}
+	return nil
+}
 
-		// Ensure parent directory exists
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return fmt.Errorf("failed to create parent directory for %s: %v", path, err)
-		}
+// renderConfigFile renders a single embedded template to the same path on disk.
+// In a dry run the file is only rendered in memory.
+func renderConfigFile(path string, config Config) error {
+	rendered, err := renderTemplate(path, config)
+	if err != nil {
+		return err
+	}
 
-		// Create output file
-		outFile, err := os.Create(path)
-		if err != nil {
-			return fmt.Errorf("failed to create %s: %v", path, err)
-		}
-		defer outFile.Close()
+	// Ensure parent directory exists
+	if err := mkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory for %s: %v", path, err)
+	}
 
-		// Execute template
-		if err := tmpl.Execute(outFile, config); err != nil {
-			return fmt.Errorf("failed to execute template %s: %v", path, err)
-		}
+	// Write output file, keeping files with secrets private
+	perm := os.FileMode(0644)
+	if isSensitiveFile(path, config) {
+		perm = 0600
+	}
+	if err := writeFile(path, rendered, perm); err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
 
-		return nil
-	})
-	if err != nil {
-		return fmt.Errorf("error walking config files: %v", err)
+	if isSensitiveFile(path, config) {
+		return secureFile(path)
 	}
 
 	return nil
 }
 
+// renderTemplate renders a single template with config.
+func renderTemplate(path string, config Config) ([]byte, error) {
+	return renderTemplateFrom(templates, path, config)
+}
+
+// renderTemplateFrom renders a single template of fsys with config.
+func renderTemplateFrom(fsys fs.FS, path string, config Config) ([]byte, error) {
+	// Read the template file
+	content, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	// HTML pages are templates of the services themselves and are used as is
+	if filepath.Ext(path) == ".html" {
+		return content, nil
+	}
+
+	// Parse template, failing on missing variables instead of rendering "<no value>"
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %v", path, err)
+	}
+
+	// Execute template
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, config); err != nil {
+		return nil, fmt.Errorf("failed to execute template %s: %v", path, err)
+	}
+
+	// Make sure the result is still valid YAML
+	if ext := filepath.Ext(path); ext == ".yml" || ext == ".yaml" {
+		var parsed interface{}
+		if err := yaml.Unmarshal(rendered.Bytes(), &parsed); err != nil {
+			return nil, fmt.Errorf("template %s rendered invalid YAML: %v", path, err)
+		}
+	}
+
+	return rendered.Bytes(), nil
+}
+
 func copyFile(src, dst string) error {
+	if isDryRun() {
+		content, err := readFile(src)
+		if err != nil {
+			return err
+		}
+		return writeFile(dst, content, 0644)
+	}
+
 	source, err := os.Open(src)
 	if err != nil {
 		return err
@@ -488,14 +685,26 @@ func copyFile(src, dst string) error {
 }
 
 func moveFile(src, dst string) error {
+	// Renaming keeps the permissions and owner of files holding secrets
+	if !isDryRun() {
+		if err := os.Rename(src, dst); err == nil {
+			return nil
+		}
+	}
+
 	if err := copyFile(src, dst); err != nil {
 		return err
 	}
 
-	return os.Remove(src)
+	return removeFile(src)
 }
 
 func printSetupToken(containerType SupportedContainer, dashboardDomain string) {
+	if isDryRun() {
+		fmt.Println("Dry run: the setup token will be printed from the Pangolin logs once the containers are running.")
+		return
+	}
+
 	fmt.Println("Waiting for Pangolin to generate setup token...")
 
 	// Wait for Pangolin to be healthy
@@ -582,25 +791,14 @@ func showSetupTokenInstructions(containerType SupportedContainer, dashboardDomai
 	fmt.Println("================================")
 }
 
-func generateRandomSecretKey() string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	const length = 32
-
-	var seededRand *rand.Rand = rand.New(
-		rand.NewSource(time.Now().UnixNano()))
-
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
-	}
-	return string(b)
-}
-
 func getPublicIP() string {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
 
+	// Only used as a default for the prompts, so it is looked up in a dry run too
+	dryRunDownload("https://ifconfig.io/ip")
+
 	resp, err := client.Get("https://ifconfig.io/ip")
 	if err != nil {
 		return ""
@@ -624,6 +822,10 @@ func getPublicIP() string {
 
 // Run external commands with stdio/stderr attached.
 func run(name string, args ...string) error {
+	if dryRunCommand(name, args...) {
+		return nil
+	}
+
 	cmd := exec.Command(name, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -647,31 +849,3 @@ func checkPortsAvailable(port int) error {
 	}
 	return nil
 }
-
-func downloadMaxMindDatabase() error {
-	fmt.Println("Downloading MaxMind GeoLite2 Country database...")
-
-	// Download the GeoLite2 Country database
-	if err := run("curl", "-L", "-o", "GeoLite2-Country.tar.gz",
-		"https://github.com/GitSquared/node-geolite2-redist/raw/refs/heads/master/redist/GeoLite2-Country.tar.gz"); err != nil {
-		return fmt.Errorf("failed to download GeoLite2 database: %v", err)
-	}
-
-	// Extract the database
-	if err := run("tar", "-xzf", "GeoLite2-Country.tar.gz"); err != nil {
-		return fmt.Errorf("failed to extract GeoLite2 database: %v", err)
-	}
-
-	// Find the .mmdb file and move it to the config directory
-	if err := run("bash", "-c", "mv GeoLite2-Country_*/GeoLite2-Country.mmdb config/"); err != nil {
-		return fmt.Errorf("failed to move GeoLite2 database to config directory: %v", err)
-	}
-
-	// Clean up the downloaded files
-	if err := run("rm", "-rf", "GeoLite2-Country.tar.gz", "GeoLite2-Country_*"); err != nil {
-		fmt.Printf("Warning: failed to clean up temporary files: %v\n", err)
-	}
-
-	fmt.Println("MaxMind GeoLite2 Country database downloaded successfully!")
-	return nil
-}
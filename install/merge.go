@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergeRulesKey is a top-level key of an overlay file selecting how lists
+// are merged. It maps dotted paths to a strategy and is not merged itself:
+//
+//	x-merge:
+//	  entryPoints.websecure.http.middlewares: union
+//	  http.services.*.loadBalancer.servers: keyed:url
+//
+// A "*" segment matches any key, "-" addresses the items of a list merged
+// with keyed. Lists without a rule are replaced, as before.
+const mergeRulesKey = "x-merge"
+
+const (
+	mergeReplace = "replace" // the overlay list replaces the base list
+	mergeAppend  = "append"  // overlay items are added after the base items
+	mergeUnion   = "union"   // adds the overlay items that are not present yet
+	mergeKeyed   = "keyed"   // maps with the same key field are merged, others appended
+)
+
+type mergeStrategy struct {
+	kind string
+	key  string
+}
+
+type mergeRule struct {
+	path     []string
+	strategy mergeStrategy
+}
+
+type mergeRules []mergeRule
+
+func parseMergeStrategy(value string) (mergeStrategy, error) {
+	kind, key, _ := strings.Cut(strings.TrimSpace(value), ":")
+	switch kind {
+	case mergeReplace, mergeAppend, mergeUnion:
+		if key != "" {
+			return mergeStrategy{}, fmt.Errorf("merge strategy %q takes no key", kind)
+		}
+		return mergeStrategy{kind: kind}, nil
+	case mergeKeyed:
+		if key == "" {
+			return mergeStrategy{}, fmt.Errorf("merge strategy keyed needs a key field, e.g. keyed:name")
+		}
+		return mergeStrategy{kind: kind, key: key}, nil
+	}
+	return mergeStrategy{}, fmt.Errorf("unknown merge strategy %q", value)
+}
+
+// extractMergeRules reads and removes the x-merge section of an overlay.
+func extractMergeRules(overlay *yaml.Node) (mergeRules, error) {
+	var rules mergeRules
+	for i := 0; i < len(overlay.Content)-1; i += 2 {
+		if overlay.Content[i].Value != mergeRulesKey {
+			continue
+		}
+
+		section := overlay.Content[i+1]
+		if section.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s must map paths to merge strategies", mergeRulesKey)
+		}
+		for j := 0; j < len(section.Content)-1; j += 2 {
+			strategy, err := parseMergeStrategy(section.Content[j+1].Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", section.Content[j].Value, err)
+			}
+			rules = append(rules, mergeRule{path: strings.Split(section.Content[j].Value, "."), strategy: strategy})
+		}
+
+		overlay.Content = append(overlay.Content[:i], overlay.Content[i+2:]...)
+		break
+	}
+	return rules, nil
+}
+
+// strategyFor returns the strategy of the last rule matching path.
+func (r mergeRules) strategyFor(path []string) mergeStrategy {
+	strategy := mergeStrategy{kind: mergeReplace}
+	for _, rule := range r {
+		if matchMergePath(rule.path, path) {
+			strategy = rule.strategy
+		}
+	}
+	return strategy
+}
+
+func matchMergePath(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeYAMLNodes merges the overlay mapping into base. Nested mappings are
+// merged recursively, lists according to the rules and every other value of
+// the overlay replaces the one in base. Keys new to base are appended in the
+// overlay's order.
+func mergeYAMLNodes(base, overlay *yaml.Node, rules mergeRules, path []string) error {
+	for i := 0; i < len(overlay.Content)-1; i += 2 {
+		key, value := overlay.Content[i], overlay.Content[i+1]
+		childPath := append(path[:len(path):len(path)], key.Value)
+
+		existing := yamlMappingValue(base, key.Value)
+		if existing == nil {
+			base.Content = append(base.Content, copyYAMLNode(key), copyYAMLNode(value))
+			continue
+		}
+
+		if value.Kind == yaml.MappingNode && (existing.Kind == yaml.MappingNode || existing.Kind == yaml.AliasNode) {
+			child, err := yamlChildMapping(base, key.Value)
+			if err != nil {
+				return err
+			}
+			if err := mergeYAMLNodes(child, value, rules, childPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		strategy := rules.strategyFor(childPath)
+		if value.Kind == yaml.SequenceNode && strategy.kind != mergeReplace {
+			list := yamlChildValue(base, key.Value)
+			if list.Kind == yaml.SequenceNode {
+				if err := mergeYAMLLists(list, value, strategy, rules, childPath); err != nil {
+					return fmt.Errorf("%s: %v", strings.Join(childPath, "."), err)
+				}
+				continue
+			}
+		}
+
+		replaceYAMLNode(existing, copyYAMLNode(value))
+	}
+	return nil
+}
+
+// mergeYAMLLists merges the overlay items into the base list.
+func mergeYAMLLists(base, overlay *yaml.Node, strategy mergeStrategy, rules mergeRules, path []string) error {
+	for i, item := range overlay.Content {
+		switch strategy.kind {
+		case mergeAppend:
+			base.Content = append(base.Content, copyYAMLNode(item))
+
+		case mergeUnion:
+			if yamlListIndex(base, item) >= 0 {
+				continue
+			}
+			// Keep the overlay's order relative to items both lists share,
+			// e.g. a middleware that has to run before another one
+			at := len(base.Content)
+			for _, next := range overlay.Content[i+1:] {
+				if j := yamlListIndex(base, next); j >= 0 {
+					at = j
+					break
+				}
+			}
+			base.Content = append(base.Content[:at], append([]*yaml.Node{copyYAMLNode(item)}, base.Content[at:]...)...)
+
+		case mergeKeyed:
+			id := yamlMappingValue(item, strategy.key)
+			if id == nil {
+				return fmt.Errorf("list item has no %q field to merge by", strategy.key)
+			}
+			if match := yamlListItemByKey(base, strategy.key, id.Value); match != nil {
+				if err := mergeYAMLNodes(match, item, rules, append(path[:len(path):len(path)], "-")); err != nil {
+					return err
+				}
+				continue
+			}
+			base.Content = append(base.Content, copyYAMLNode(item))
+		}
+	}
+	return nil
+}
+
+// yamlListIndex returns the index of the first item of list equal in value
+// to item, whatever quoting or layout either uses, or -1.
+func yamlListIndex(list, item *yaml.Node) int {
+	var want interface{}
+	if err := item.Decode(&want); err != nil {
+		return -1
+	}
+	for i, existing := range list.Content {
+		var have interface{}
+		if err := existing.Decode(&have); err == nil && reflect.DeepEqual(have, want) {
+			return i
+		}
+	}
+	return -1
+}
+
+// yamlListItemByKey returns the mapping in a list whose key field equals
+// value. Aliased items are detached first so the merge stays local.
+func yamlListItemByKey(list *yaml.Node, key, value string) *yaml.Node {
+	for i, item := range list.Content {
+		if item.Kind == yaml.AliasNode {
+			item = item.Alias
+		}
+		if id := yamlMappingValue(item, key); id == nil || id.Value != value {
+			continue
+		}
+		if list.Content[i].Kind == yaml.AliasNode {
+			item = copyYAMLNode(item)
+			item.Anchor = ""
+			list.Content[i] = item
+		}
+		return item
+	}
+	return nil
+}
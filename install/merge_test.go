@@ -0,0 +1,253 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+var testConfig = Config{
+	DashboardDomain:  "pangolin.example.com",
+	LetsEncryptEmail: "admin@example.com",
+	BadgerVersion:    "v1.2.0",
+}
+
+// renderTestConfigs renders the embedded templates at paths into a fresh
+// working directory.
+func renderTestConfigs(t *testing.T, paths ...string) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	for _, path := range paths {
+		if err := renderConfigFile(path, testConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func editTestFile(t *testing.T, path, old, new string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), old) {
+		t.Fatalf("%s does not contain %q", path, old)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(content), old, new, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lookupTestValue decodes path and returns the value at the dotted key.
+func lookupTestValue(t *testing.T, path, key string) interface{} {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		t.Fatalf("%s is not valid YAML: %v", path, err)
+	}
+	for _, k := range strings.Split(key, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s: %s not found", path, key)
+		}
+		value = m[k]
+	}
+	return value
+}
+
+func assertTestValue(t *testing.T, path, key string, want interface{}) {
+	t.Helper()
+	if got := lookupTestValue(t, path, key); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: %s = %v, want %v", path, key, got, want)
+	}
+}
+
+func TestMergeCrowdsecTraefikConfig(t *testing.T) {
+	base, overlay := "config/traefik/traefik_config.yml", "config/crowdsec/traefik_config.yml"
+	renderTestConfigs(t, base, overlay)
+
+	// An admin added their own middleware and documented it
+	editTestFile(t, base, "      tls:\n        certResolver: \"letsencrypt\"",
+		"      tls:\n        certResolver: \"letsencrypt\"\n      # Forward auth for the whole site\n      middlewares:\n        - my-auth@file")
+
+	if err := MergeYAML(base, overlay); err != nil {
+		t.Fatal(err)
+	}
+
+	assertTestValue(t, base, "entryPoints.websecure.http.middlewares", []interface{}{"my-auth@file", "crowdsec@file"})
+	assertTestValue(t, base, "experimental.plugins.badger.version", "v1.2.0")
+	assertTestValue(t, base, "experimental.plugins.crowdsec.version", "v1.4.4")
+	assertTestValue(t, base, "log.format", "json")
+	assertTestValue(t, base, "accessLog.filePath", "/var/log/traefik/access.log")
+	assertTestValue(t, base, mergeRulesKey, nil)
+
+	content, _ := os.ReadFile(base)
+	for _, comment := range []string{"# Forward auth for the whole site", "# Log format changed to json"} {
+		if !strings.Contains(string(content), comment) {
+			t.Errorf("merged file lost comment %q", comment)
+		}
+	}
+}
+
+func TestMergeCrowdsecDynamicConfig(t *testing.T) {
+	base, overlay := "config/traefik/dynamic_config.yml", "config/crowdsec/dynamic_config.yml"
+	renderTestConfigs(t, base, overlay)
+
+	// Custom middleware on a router and a second upstream for the dashboard
+	editTestFile(t, base, "      middlewares:\n        - badger\n      tls:",
+		"      middlewares:\n        - badger\n        - rate-limit@file\n      tls:")
+	editTestFile(t, base, "          - url: \"http://pangolin:3002\"  # Next.js server",
+		"          - url: \"http://pangolin:3002\"  # Next.js server\n          - url: \"http://pangolin-2:3002\"")
+
+	if err := MergeYAML(base, overlay); err != nil {
+		t.Fatal(err)
+	}
+
+	// security-headers keeps its place in front of badger
+	assertTestValue(t, base, "http.routers.next-router.middlewares", []interface{}{"security-headers", "badger", "rate-limit@file"})
+	assertTestValue(t, base, "http.routers.api-router.middlewares", []interface{}{"security-headers", "badger"})
+	assertTestValue(t, base, "http.routers.main-app-router-redirect.middlewares", []interface{}{"redirect-to-https", "badger"})
+	assertTestValue(t, base, "http.services.next-service.loadBalancer.servers", []interface{}{
+		map[string]interface{}{"url": "http://pangolin:3002"},
+		map[string]interface{}{"url": "http://pangolin-2:3002"},
+	})
+	assertTestValue(t, base, "http.middlewares.crowdsec.plugin.crowdsec.crowdsecLapiKey", "PUT_YOUR_BOUNCER_KEY_HERE_OR_IT_WILL_NOT_WORK")
+	assertTestValue(t, base, "http.routers.next-router.rule", "Host(`pangolin.example.com`) && !PathPrefix(`/api/v1`)")
+
+	content, _ := os.ReadFile(base)
+	if !strings.Contains(string(content), "# Next.js router (handles everything except API and WebSocket paths)") {
+		t.Error("merged file lost the router comments")
+	}
+}
+
+func TestMergeCrowdsecOverlaysAreIdempotent(t *testing.T) {
+	for _, name := range []string{"traefik_config.yml", "dynamic_config.yml"} {
+		base, overlay := "config/traefik/"+name, "config/crowdsec/"+name
+		renderTestConfigs(t, base, overlay)
+
+		if err := MergeYAML(base, overlay); err != nil {
+			t.Fatal(err)
+		}
+		once, _ := os.ReadFile(base)
+		if err := MergeYAML(base, overlay); err != nil {
+			t.Fatal(err)
+		}
+		twice, _ := os.ReadFile(base)
+
+		if string(once) != string(twice) {
+			t.Errorf("merging %s twice changed the result", overlay)
+		}
+	}
+}
+
+func TestMergeStrategies(t *testing.T) {
+	base := `list:
+  - a
+  - b
+servers:
+  - url: one
+    weight: 1
+  - url: two
+`
+	tests := []struct {
+		rule string
+		want map[string]interface{}
+	}{
+		{
+			rule: "",
+			want: map[string]interface{}{
+				"list":    []interface{}{"c", "a"},
+				"servers": []interface{}{map[string]interface{}{"url": "one", "weight": 5}},
+			},
+		},
+		{
+			rule: "list: append\n  servers: append",
+			want: map[string]interface{}{
+				"list": []interface{}{"a", "b", "c", "a"},
+				"servers": []interface{}{
+					map[string]interface{}{"url": "one", "weight": 1},
+					map[string]interface{}{"url": "two"},
+					map[string]interface{}{"url": "one", "weight": 5},
+				},
+			},
+		},
+		{
+			rule: "list: union\n  servers: union",
+			want: map[string]interface{}{
+				"list": []interface{}{"c", "a", "b"},
+				"servers": []interface{}{
+					map[string]interface{}{"url": "one", "weight": 1},
+					map[string]interface{}{"url": "two"},
+					map[string]interface{}{"url": "one", "weight": 5},
+				},
+			},
+		},
+		{
+			rule: "servers: keyed:url",
+			want: map[string]interface{}{
+				"list": []interface{}{"c", "a"},
+				"servers": []interface{}{
+					map[string]interface{}{"url": "one", "weight": 5},
+					map[string]interface{}{"url": "two"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+
+			overlay := "list:\n  - c\n  - a\nservers:\n  - url: one\n    weight: 5\n"
+			if tt.rule != "" {
+				overlay = "x-merge:\n  " + tt.rule + "\n" + overlay
+			}
+			os.WriteFile("base.yml", []byte(base), 0644)
+			os.WriteFile("overlay.yml", []byte(overlay), 0644)
+
+			if err := MergeYAML("base.yml", "overlay.yml"); err != nil {
+				t.Fatal(err)
+			}
+
+			content, _ := os.ReadFile("base.yml")
+			var got map[string]interface{}
+			if err := yaml.Unmarshal(content, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeRulesWildcard(t *testing.T) {
+	rules := mergeRules{
+		{path: []string{"http", "routers", "*", "middlewares"}, strategy: mergeStrategy{kind: mergeUnion}},
+		{path: []string{"http", "routers", "api", "middlewares"}, strategy: mergeStrategy{kind: mergeAppend}},
+	}
+
+	if got := rules.strategyFor([]string{"http", "routers", "next", "middlewares"}).kind; got != mergeUnion {
+		t.Errorf("wildcard rule: got %s, want %s", got, mergeUnion)
+	}
+	if got := rules.strategyFor([]string{"http", "routers", "api", "middlewares"}).kind; got != mergeAppend {
+		t.Errorf("later rule: got %s, want %s", got, mergeAppend)
+	}
+	if got := rules.strategyFor([]string{"http", "routers", "next", "entryPoints"}).kind; got != mergeReplace {
+		t.Errorf("no rule: got %s, want %s", got, mergeReplace)
+	}
+
+	if _, err := parseMergeStrategy("keyed"); err == nil {
+		t.Error("keyed without a field should be rejected")
+	}
+	if _, err := parseMergeStrategy("zip"); err == nil {
+		t.Error("unknown strategy should be rejected")
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// showProgress reports whether pulling and starting the containers is shown
+// as a status line per service instead of the raw compose output.
+func showProgress() bool {
+	return useTUI() && !isDryRun()
+}
+
+type serviceProgress struct {
+	name      string
+	container string
+	state     string
+	done      bool
+	failed    bool
+	output    []byte
+}
+
+// progressView redraws one status line per compose service in place.
+type progressView struct {
+	mu       sync.Mutex
+	services []*serviceProgress
+	drawn    int
+	frame    int
+}
+
+func newProgressView() (*progressView, error) {
+	compose, err := loadComposeFile("docker-compose.yml")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &progressView{}
+	for _, name := range compose.serviceNames() {
+		container := compose.Services[name].ContainerName
+		if container == "" {
+			container = name
+		}
+		p.services = append(p.services, &serviceProgress{name: name, container: container, state: "waiting"})
+	}
+	return p, nil
+}
+
+func (p *progressView) set(s *serviceProgress, state string, done, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s.state, s.done, s.failed = state, done, failed
+}
+
+func (p *progressView) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	spinner := []string{"|", "/", "-", "\\"}
+	p.frame++
+
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", p.drawn)
+	}
+	for _, s := range p.services {
+		symbol := spinner[p.frame%len(spinner)]
+		switch {
+		case s.failed:
+			symbol = styleRed + "x" + styleReset
+		case s.done:
+			symbol = styleGreen + "+" + styleReset
+		case s.state == "waiting":
+			symbol = styleDim + "." + styleReset
+		}
+		fmt.Fprintf(&b, "\x1b[2K  %s %-12s %s\n", symbol, s.name, s.state)
+	}
+	p.drawn = len(p.services)
+	fmt.Print(b.String())
+}
+
+// during redraws the view until work returns.
+func (p *progressView) during(work func()) {
+	done := make(chan struct{})
+	go func() {
+		work()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(150 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		p.draw()
+		select {
+		case <-done:
+			p.draw()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pullContainersWithProgress pulls the image of each service in turn.
+func pullContainersWithProgress() error {
+	p, err := newProgressView()
+	if err != nil {
+		return err
+	}
+
+	p.during(func() {
+		for _, s := range p.services {
+			p.set(s, "pulling", false, false)
+			cmd, err := dockerComposeCommand("-f", "docker-compose.yml", "pull", "--policy", "always", s.name)
+			if err == nil {
+				s.output, err = cmd.CombinedOutput()
+			}
+			if err != nil {
+				p.set(s, fmt.Sprintf("failed: %v", err), true, true)
+				continue
+			}
+			p.set(s, "pulled", true, false)
+		}
+	})
+
+	var failed []string
+	for _, s := range p.services {
+		if s.failed {
+			failed = append(failed, s.name)
+			fmt.Printf("\n%s:\n%s", s.name, s.output)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to pull the containers: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// startContainersWithProgress starts the stack and follows each container
+// until it runs, or is healthy when it has a healthcheck.
+func startContainersWithProgress() error {
+	p, err := newProgressView()
+	if err != nil {
+		return err
+	}
+
+	var upErr error
+	var upOutput []byte
+	p.during(func() {
+		upDone := make(chan error, 1)
+		go func() {
+			cmd, err := dockerComposeCommand("-f", "docker-compose.yml", "up", "-d", "--force-recreate")
+			if err == nil {
+				upOutput, err = cmd.CombinedOutput()
+			}
+			upDone <- err
+		}()
+
+		var deadline time.Time
+		for {
+			select {
+			case upErr = <-upDone:
+				if upErr != nil {
+					return
+				}
+				deadline = time.Now().Add(3 * time.Minute)
+			default:
+			}
+
+			settled := true
+			for _, s := range p.services {
+				state, done, failed := containerState(s.container)
+				p.set(s, state, done, failed)
+				settled = settled && (done || failed)
+			}
+			if !deadline.IsZero() && (settled || time.Now().After(deadline)) {
+				return
+			}
+			time.Sleep(time.Second)
+		}
+	})
+
+	if upErr != nil {
+		fmt.Printf("%s", upOutput)
+		return fmt.Errorf("failed to start containers: %v", upErr)
+	}
+
+	for _, s := range p.services {
+		switch {
+		case s.failed:
+			fmt.Printf("%s is %s, check its logs with: docker logs %s\n", s.name, s.state, s.container)
+		case !s.done:
+			fmt.Printf("%s is still %s, check on it with: docker ps\n", s.name, s.state)
+		}
+	}
+	return nil
+}
+
+// containerState describes a container for the progress view and reports
+// whether it is up or has failed.
+func containerState(container string) (string, bool, bool) {
+	out, err := exec.Command("docker", "container", "inspect", "-f", "{{.State.Status}} {{if .State.Health}}{{.State.Health.Status}}{{end}}", container).Output()
+	if err != nil {
+		return "waiting", false, false
+	}
+
+	status, health, _ := strings.Cut(strings.TrimSpace(string(out)), " ")
+	switch {
+	case status == "exited" || status == "dead":
+		return status, false, true
+	case status != "running":
+		return status, false, false
+	case health == "":
+		return "running", true, false
+	case health == "healthy":
+		return "healthy", true, false
+	case health == "unhealthy":
+		return "unhealthy", false, true
+	}
+	return "starting", false, false
+}
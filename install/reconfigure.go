@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const acmeStoragePath = "config/letsencrypt/acme.json"
+
+// reconfigureDomains moves an existing install to a new dashboard domain
+// and/or base domain, updating every place the installer wrote them.
+func reconfigureDomains(args []string) error {
+	fs := flag.NewFlagSet("reconfigure", flag.ExitOnError)
+	dashboardDomain := fs.String("dashboard-domain", "", "New domain of the Pangolin dashboard (prompted for when omitted)")
+	baseDomain := fs.String("base-domain", "", "Base domain to change as old=new, or just the new one when the install has a single base domain (prompted for when omitted)")
+	fs.Usage = func() {
+		fmt.Println("Usage: installer reconfigure [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if _, err := os.Stat("config/config.yml"); err != nil {
+		return fmt.Errorf("no Pangolin install found in the current directory")
+	}
+
+	appConfig, err := ReadAppConfig("config/config.yml")
+	if err != nil {
+		return err
+	}
+	parsedURL, err := url.Parse(appConfig.DashboardURL)
+	if err != nil {
+		return fmt.Errorf("error parsing dashboard URL: %v", err)
+	}
+	if len(appConfig.BaseDomains) == 0 {
+		return fmt.Errorf("no base domains found in config/config.yml")
+	}
+	oldDashboard := parsedURL.Hostname()
+
+	reader := bufio.NewReader(os.Stdin)
+	entry, newBase, err := selectBaseDomain(reader, appConfig.BaseDomains, *baseDomain)
+	if err != nil {
+		return err
+	}
+	oldBase := entry.Domain
+	newDashboard := *dashboardDomain
+	if newDashboard == "" {
+		defaultDashboard := oldDashboard
+		if newBase != oldBase && strings.HasSuffix(oldDashboard, "."+oldBase) {
+			defaultDashboard = strings.TrimSuffix(oldDashboard, oldBase) + newBase
+		}
+		newDashboard, _ = readString(reader, "Enter the new domain for the Pangolin dashboard", defaultDashboard)
+	}
+	newBase, newDashboard = strings.ToLower(newBase), strings.ToLower(newDashboard)
+
+	for _, domain := range []string{newBase, newDashboard} {
+		if !isDomainName(domain) {
+			return fmt.Errorf("%q is not a valid domain name", domain)
+		}
+	}
+	if newBase != oldBase && slices.ContainsFunc(appConfig.BaseDomains, func(d BaseDomain) bool { return d.Domain == newBase }) {
+		return fmt.Errorf("%s is already a base domain of this install", newBase)
+	}
+	if newBase == oldBase && newDashboard == oldDashboard {
+		fmt.Println("The domains are unchanged.")
+		return nil
+	}
+
+	if newDashboard != oldDashboard {
+		fmt.Println("\n=== Checking DNS ===")
+		if err := checkDomainDNS(newDashboard); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			if !readBool(reader, "Continue anyway?", false) {
+				return fmt.Errorf("aborted")
+			}
+		}
+	}
+
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+
+	fmt.Println("\n=== Updating configuration ===")
+	if err := setConfigDomains("config/config.yml", oldDashboard, newDashboard, entry.Name, newBase); err != nil {
+		return err
+	}
+	fmt.Println("Updated config/config.yml")
+
+	if newDashboard != oldDashboard {
+		changed, err := replaceRouterHosts("config/traefik/dynamic_config.yml", oldDashboard, newDashboard)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Updated %d router rules in config/traefik/dynamic_config.yml\n", changed)
+
+		if err := offerAcmeCleanup(reader, oldDashboard); err != nil {
+			fmt.Printf("Error cleaning up %s: %v\n", acmeStoragePath, err)
+		}
+	}
+
+	fmt.Println("\n=== Restarting affected services ===")
+	containerType := detectContainerType()
+	services := []string{"pangolin", "traefik"}
+	if compose, err := loadComposeFile("docker-compose.yml"); err == nil && compose.HasService("gerbil") {
+		services = []string{"pangolin", "gerbil", "traefik"}
+	}
+	if err := validateInstallConfig(); err != nil {
+		return fmt.Errorf("refusing to restart containers: %v", err)
+	}
+	for _, service := range services {
+		if !isContainerRunning(service, containerType) {
+			continue
+		}
+		if err := restartContainer(service, containerType); err != nil {
+			return err
+		}
+	}
+	if isContainerRunning("pangolin", containerType) {
+		if err := waitForHealthy("pangolin", containerType); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\nPangolin is now available at https://%s\n", newDashboard)
+	return nil
+}
+
+// selectBaseDomain returns the entry of the domains section to change and
+// its new base domain, from --base-domain or by asking. Keeping the base
+// domains returns the first entry with its own domain.
+func selectBaseDomain(reader *bufio.Reader, domains []BaseDomain, value string) (BaseDomain, string, error) {
+	if value != "" {
+		oldBase, newBase, found := strings.Cut(value, "=")
+		if !found {
+			if len(domains) > 1 {
+				return BaseDomain{}, "", fmt.Errorf("the install has %d base domains, use --base-domain old=new to pick the one to change", len(domains))
+			}
+			return domains[0], strings.ToLower(strings.TrimSpace(value)), nil
+		}
+		oldBase = strings.ToLower(strings.TrimSpace(oldBase))
+		i := slices.IndexFunc(domains, func(d BaseDomain) bool { return d.Domain == oldBase })
+		if i < 0 {
+			return BaseDomain{}, "", fmt.Errorf("%s is not a base domain of this install", oldBase)
+		}
+		return domains[i], strings.ToLower(strings.TrimSpace(newBase)), nil
+	}
+
+	entry := domains[0]
+	if len(domains) > 1 {
+		fmt.Println("The install has these base domains:")
+		for i, d := range domains {
+			fmt.Printf("  %d. %s (%s)\n", i+1, d.Domain, d.Name)
+		}
+		choice := readValidatedString(reader, "Enter the number of the base domain to change, or 0 to keep them", "0", func(value string) error {
+			if n, err := strconv.Atoi(value); err != nil || n < 0 || n > len(domains) {
+				return fmt.Errorf("enter a number between 0 and %d", len(domains))
+			}
+			return nil
+		})
+		n, _ := strconv.Atoi(choice)
+		if n == 0 {
+			return entry, entry.Domain, nil
+		}
+		entry = domains[n-1]
+	}
+
+	newBase, _ := readString(reader, "Enter the new base domain for "+entry.Domain, entry.Domain)
+	return entry, newBase, nil
+}
+
+// isDomainName does a basic sanity check of a host name.
+func isDomainName(name string) bool {
+	if name == "" || len(name) > 253 || !strings.Contains(name, ".") {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkDomainDNS checks that a domain resolves to the public IP of this
+// server, so Let's Encrypt can validate it over HTTP.
+func checkDomainDNS(domain string) error {
+	ips, err := net.LookupIP(domain)
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("%s does not resolve, create an A record pointing to this server first", domain)
+	}
+
+	publicIP := getPublicIP()
+	if publicIP == "" {
+		fmt.Printf("%s resolves to %v, but the public IP of this server could not be determined.\n", domain, ips)
+		return nil
+	}
+	for _, ip := range ips {
+		if ip.Equal(net.ParseIP(publicIP)) {
+			fmt.Printf("%s resolves to this server (%s).\n", domain, publicIP)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s resolves to %v, not to this server (%s)", domain, ips, publicIP)
+}
+
+// setConfigDomains updates the domains in config.yml: the dashboard URL,
+// the gerbil endpoint, the CORS origins and the base domain of the named
+// entry of the domains section.
+func setConfigDomains(path, oldDashboard, newDashboard, domainName, newBase string) error {
+	doc, content, err := readYAMLFile(path)
+	if err != nil {
+		return err
+	}
+	root := doc.Content[0]
+
+	if err := setYAMLNodeValue(doc, "https://"+newDashboard, "app", "dashboard_url"); err != nil {
+		return err
+	}
+	if endpoint := yamlMappingValue(yamlMappingValue(root, "gerbil"), "base_endpoint"); endpoint != nil && endpoint.Value == oldDashboard {
+		endpoint.Value = newDashboard
+	}
+	if origins := yamlMappingValue(yamlMappingValue(yamlMappingValue(root, "server"), "cors"), "origins"); origins != nil && origins.Kind == yaml.SequenceNode {
+		for _, origin := range origins.Content {
+			if origin.Value == "https://"+oldDashboard {
+				origin.Value = "https://" + newDashboard
+			}
+		}
+	}
+	if base := yamlMappingValue(yamlMappingValue(yamlMappingValue(root, "domains"), domainName), "base_domain"); base != nil {
+		base.Value = newBase
+	}
+
+	return writeYAMLFile(path, doc, content)
+}
+
+// replaceRouterHosts replaces the Host(`old`) matchers in the rules of the
+// routers in a Traefik dynamic configuration and returns how many rules
+// changed.
+func replaceRouterHosts(path, oldHost, newHost string) (int, error) {
+	doc, content, err := readYAMLFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, protocol := range []string{"http", "tcp", "udp"} {
+		routers := yamlMappingValue(yamlMappingValue(doc.Content[0], protocol), "routers")
+		if routers == nil || routers.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(routers.Content); i += 2 {
+			rule := yamlMappingValue(routers.Content[i], "rule")
+			if rule == nil || rule.Kind != yaml.ScalarNode {
+				continue
+			}
+			updated := rule.Value
+			for _, matcher := range []string{"Host", "HostSNI"} {
+				updated = strings.ReplaceAll(updated, matcher+"(`"+oldHost+"`)", matcher+"(`"+newHost+"`)")
+			}
+			if updated != rule.Value {
+				rule.Value = updated
+				changed++
+			}
+		}
+	}
+
+	if changed == 0 {
+		return 0, nil
+	}
+	return changed, writeYAMLFile(path, doc, content)
+}
+
+// offerAcmeCleanup offers to remove the certificates of a domain that is no
+// longer served from Traefik's ACME storage.
+func offerAcmeCleanup(reader *bufio.Reader, domain string) error {
+	content, err := os.ReadFile(acmeStoragePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var storage map[string]map[string]interface{}
+	if err := json.Unmarshal(content, &storage); err != nil {
+		return fmt.Errorf("error parsing: %v", err)
+	}
+
+	stale := 0
+	for _, resolver := range storage {
+		certificates, _ := resolver["Certificates"].([]interface{})
+		for _, certificate := range certificates {
+			if certificateCovers(certificate, domain) {
+				stale++
+			}
+		}
+	}
+	if stale == 0 {
+		return nil
+	}
+
+	if !readBool(reader, fmt.Sprintf("Remove the %d certificate(s) for %s from %s?", stale, domain, acmeStoragePath), true) {
+		return nil
+	}
+
+	for _, resolver := range storage {
+		certificates, ok := resolver["Certificates"].([]interface{})
+		if !ok {
+			continue
+		}
+		resolver["Certificates"] = slices.DeleteFunc(certificates, func(certificate interface{}) bool {
+			return certificateCovers(certificate, domain)
+		})
+	}
+
+	data, err := json.MarshalIndent(storage, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileInPlace(acmeStoragePath, append(data, '\n')); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %d certificate(s) for %s.\n", stale, domain)
+	return nil
+}
+
+// certificateCovers reports whether an ACME storage certificate entry was
+// issued for domain.
+func certificateCovers(certificate interface{}, domain string) bool {
+	entry, _ := certificate.(map[string]interface{})
+	names, _ := entry["domain"].(map[string]interface{})
+	if main, _ := names["main"].(string); main == domain {
+		return true
+	}
+	sans, _ := names["sans"].([]interface{})
+	for _, san := range sans {
+		if san == domain {
+			return true
+		}
+	}
+	return false
+}
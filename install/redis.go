@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RedisNode is the address of a Redis read replica.
+type RedisNode struct {
+	Host string
+	Port int
+}
+
+// RedisReplicaPasswordVars returns the environment variables that pass the
+// Redis password to Pangolin for each replica when it is not inlined.
+func (c Config) RedisReplicaPasswordVars() []string {
+	vars := make([]string, 0, len(c.RedisReplicas))
+	for i := range c.RedisReplicas {
+		vars = append(vars, fmt.Sprintf("REDIS_REPLICA_%d_PASSWORD", i+1))
+	}
+	return vars
+}
+
+const (
+	redisModeBundled  = "bundled"
+	redisModeExternal = "external"
+	redisModeNone     = "none"
+)
+
+// collectRedisInput asks how the Enterprise edition should reach Redis. A
+// bundled Redis runs as a service in the compose file with a generated
+// password; an external Redis is only referenced from the private config.
+func collectRedisInput(reader *bufio.Reader, config *Config) {
+	fmt.Println("\n=== Redis Configuration ===")
+	fmt.Println("Redis is required to run more than one Pangolin replica. It can be deployed alongside Pangolin or you can connect to an existing server.")
+
+	mode := ""
+	for {
+		mode = strings.ToLower(readStringFlag(reader, "redis", "Would you like to use a bundled Redis, an external Redis or none? (bundled/external/none)", redisModeNone))
+		if mode == redisModeBundled || mode == redisModeExternal || mode == redisModeNone {
+			break
+		}
+		fmt.Printf("Unrecognized Redis option: %s. Valid options are 'bundled', 'external' or 'none'.\n", mode)
+		if flagIsSet("redis") {
+			os.Exit(1)
+		}
+	}
+
+	switch mode {
+	case redisModeBundled:
+		config.EnableRedis = true
+		config.InstallRedis = true
+		config.RedisHost = "redis"
+		config.RedisPort = 6379
+		config.RedisPassword = generateRandomSecretKey()
+		config.RedisDB = 0
+	case redisModeExternal:
+		config.EnableRedis = true
+		config.RedisHost = readValidatedStringFlag(reader, "redis-host", "Enter the Redis host", "", validateRequired)
+		config.RedisPort = readPortFlag(reader, "redis-port", "Enter the Redis port", 6379)
+		if flagIsSet("redis-password") || readBool(reader, "Does your Redis server require a password?", true) {
+			config.RedisPassword = readPasswordFlag(reader, "redis-password", "Enter the Redis password")
+		}
+		config.RedisDB = readIntFlag(reader, "redis-db", "Enter the Redis database number", 0)
+
+		for {
+			replicas, err := parseRedisReplicas(readStringFlag(reader, "redis-replicas", "Enter any Redis read replicas as a comma separated host:port list (leave empty for none)", ""))
+			if err == nil {
+				config.RedisReplicas = replicas
+				break
+			}
+			fmt.Printf("Error: %v\n", err)
+			if flagIsSet("redis-replicas") {
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// parseRedisReplicas parses a comma separated list of host:port pairs.
+func parseRedisReplicas(value string) ([]RedisNode, error) {
+	var replicas []RedisNode
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		host, portStr, err := net.SplitHostPort(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Redis replica %q: %v", entry, err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port in Redis replica %q", entry)
+		}
+
+		replicas = append(replicas, RedisNode{Host: host, Port: port})
+	}
+	return replicas, nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// reviewItem is an answer listed on the review screen. edit asks the
+// questions behind it again; items with a visible func are only listed
+// when it returns true.
+type reviewItem struct {
+	label   string
+	value   func(c Config) string
+	edit    func(reader *bufio.Reader, c *Config)
+	visible func(c Config) bool
+}
+
+var reviewItems = []reviewItem{
+	{
+		label: "Edition",
+		value: func(c Config) string {
+			if c.IsEnterprise {
+				return "Enterprise"
+			}
+			return "Community"
+		},
+		edit: func(reader *bufio.Reader, c *Config) {
+			wasEnterprise := c.IsEnterprise
+			c.IsEnterprise = readBool(reader, "Do you want to install the Enterprise version of Pangolin?", c.IsEnterprise)
+			if c.IsEnterprise && !wasEnterprise {
+				collectEnterpriseInput(reader, c)
+				collectRedisInput(reader, c)
+			} else if !c.IsEnterprise {
+				resetBranding(c)
+				resetRedis(c)
+			}
+		},
+	},
+	{
+		label: "Base domains",
+		value: func(c Config) string {
+			domains := make([]string, 0, len(c.BaseDomains))
+			for _, d := range c.BaseDomains {
+				var settings []string
+				if d.CertResolver != "" {
+					settings = append(settings, "cert resolver "+d.CertResolver)
+				}
+				if d.PreferWildcardCert != nil && *d.PreferWildcardCert {
+					settings = append(settings, "wildcard")
+				}
+				if len(settings) > 0 {
+					domains = append(domains, fmt.Sprintf("%s (%s)", d.Domain, strings.Join(settings, ", ")))
+				} else {
+					domains = append(domains, d.Domain)
+				}
+			}
+			return strings.Join(domains, ", ")
+		},
+		edit: func(reader *bufio.Reader, c *Config) {
+			c.BaseDomains = collectBaseDomains(reader)
+		},
+	},
+	{
+		label: "Dashboard domain",
+		value: func(c Config) string { return c.DashboardDomain },
+		edit: func(reader *bufio.Reader, c *Config) {
+			c.DashboardDomain = readValidatedString(reader, "Enter the domain for the Pangolin dashboard", c.DashboardDomain, validateDomain)
+		},
+	},
+	{
+		label: "Let's Encrypt email",
+		value: func(c Config) string { return c.LetsEncryptEmail },
+		edit: func(reader *bufio.Reader, c *Config) {
+			c.LetsEncryptEmail = readValidatedString(reader, "Enter email for Let's Encrypt certificates", c.LetsEncryptEmail, validateEmail)
+		},
+	},
+	{
+		label: "Gerbil tunnels",
+		value: func(c Config) string { return yesNo(c.InstallGerbil) },
+		edit: func(reader *bufio.Reader, c *Config) {
+			c.InstallGerbil = readBool(reader, "Do you want to use Gerbil to allow tunneled connections", c.InstallGerbil)
+		},
+	},
+	{
+		label: "Email (SMTP)",
+		value: func(c Config) string {
+			if !c.EnableEmail {
+				return "disabled"
+			}
+			return fmt.Sprintf("%s:%d as %s, from %s", c.EmailSMTPHost, c.EmailSMTPPort, c.EmailSMTPUser, c.EmailNoReply)
+		},
+		edit: func(reader *bufio.Reader, c *Config) {
+			c.EmailSMTPHost, c.EmailSMTPPort, c.EmailSMTPUser, c.EmailSMTPPass, c.EmailNoReply = "", 0, "", "", ""
+			c.EmailSMTPSecure, c.EmailSMTPTLSRejectUnauthorized = false, false
+			collectEmailInput(reader, c)
+		},
+	},
+	{
+		label: "Branding",
+		value: func(c Config) string {
+			if !c.EnableBranding {
+				return "default"
+			}
+			value := c.BrandingAppName
+			if c.BrandingLogoLightFile != "" {
+				value += ", logo " + c.BrandingLogoLightFile
+			}
+			return value
+		},
+		edit: func(reader *bufio.Reader, c *Config) {
+			resetBranding(c)
+			collectEnterpriseInput(reader, c)
+		},
+		visible: func(c Config) bool { return c.IsEnterprise },
+	},
+	{
+		label: "Redis",
+		value: func(c Config) string {
+			switch {
+			case !c.EnableRedis:
+				return "none"
+			case c.InstallRedis:
+				return "bundled"
+			}
+			value := fmt.Sprintf("external at %s:%d, database %d", c.RedisHost, c.RedisPort, c.RedisDB)
+			if len(c.RedisReplicas) > 0 {
+				value += fmt.Sprintf(", %d replicas", len(c.RedisReplicas))
+			}
+			return value
+		},
+		edit: func(reader *bufio.Reader, c *Config) {
+			resetRedis(c)
+			collectRedisInput(reader, c)
+		},
+		visible: func(c Config) bool { return c.IsEnterprise },
+	},
+	{
+		label: "IPv6",
+		value: func(c Config) string { return yesNo(c.EnableIPv6) },
+		edit: func(reader *bufio.Reader, c *Config) {
+			c.EnableIPv6 = readBool(reader, "Is your server IPv6 capable?", c.EnableIPv6)
+		},
+	},
+	{
+		label: "GeoLite2 databases",
+		value: func(c Config) string {
+			if !c.EnableGeoblocking {
+				return "none"
+			}
+			value := "country"
+			if c.EnableASN {
+				value = "country and ASN"
+			}
+			if c.MaxMind.valid() {
+				return value + ", from MaxMind"
+			}
+			return value + ", from the public mirror"
+		},
+		edit: func(reader *bufio.Reader, c *Config) {
+			collectGeoIPInput(reader, c, c.EnableGeoblocking)
+		},
+	},
+	{
+		label: "CrowdSec",
+		value: func(c Config) string {
+			if !c.DoCrowdsecInstall {
+				return "no"
+			}
+			value := "yes"
+			if len(c.CrowdsecTrustedProxies) > 0 {
+				value += ", trusting proxies " + strings.Join(c.CrowdsecTrustedProxies, ", ")
+			}
+			if len(c.CrowdsecTrustedClients) > 0 {
+				value += ", never blocking " + strings.Join(c.CrowdsecTrustedClients, ", ")
+			}
+			if c.CrowdsecCaptchaProvider != "" {
+				value += ", captchas by " + c.CrowdsecCaptchaProvider
+			} else {
+				value += ", bans instead of captchas"
+			}
+			return value
+		},
+		edit: func(reader *bufio.Reader, c *Config) {
+			collectCrowdsecInput(reader, c)
+		},
+	},
+	{
+		label: "Secrets",
+		value: func(c Config) string {
+			switch c.SecretsMode {
+			case secretsModeFiles:
+				return "in separate env files"
+			case secretsModeDocker:
+				return "as Docker secrets"
+			}
+			return "in the config files"
+		},
+		edit: func(reader *bufio.Reader, c *Config) {
+			collectSecretsInput(reader, c)
+		},
+	},
+}
+
+// reviewUserInput lists the answers and lets the operator change any of
+// them before the configuration is written.
+func reviewUserInput(reader *bufio.Reader, config *Config) {
+	for {
+		var items []reviewItem
+		for _, item := range reviewItems {
+			if item.visible == nil || item.visible(*config) {
+				items = append(items, item)
+			}
+		}
+
+		fmt.Println("\n=== Review ===")
+		for i, item := range items {
+			fmt.Printf("  %2d. %-20s %s\n", i+1, item.label, item.value(*config))
+		}
+
+		problems := validateUserInput(*config)
+		if len(problems) > 0 {
+			fmt.Println("\nPlease fix the following before continuing:")
+			for _, problem := range problems {
+				fmt.Printf("  - %s\n", problem)
+			}
+		}
+
+		fmt.Print("\nEnter a number to change that answer, or press Enter to write the configuration: ")
+		input, err := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+
+		if input == "" {
+			if len(problems) == 0 {
+				return
+			}
+			if err != nil {
+				// Input is not interactive, so nothing can be fixed
+				fmt.Println("\nError: the configuration is incomplete")
+				os.Exit(1)
+			}
+			continue
+		}
+
+		n, convErr := strconv.Atoi(input)
+		if convErr != nil || n < 1 || n > len(items) {
+			fmt.Printf("Please enter a number between 1 and %d.\n", len(items))
+			continue
+		}
+
+		reviewing = true
+		items[n-1].edit(reader, config)
+		reviewing = false
+	}
+}
+
+// validateUserInput checks the answers the questions cannot check on their
+// own, e.g. values supplied by flags that were never asked for.
+func validateUserInput(config Config) []string {
+	var problems []string
+	check := func(label string, err error) {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", label, err))
+		}
+	}
+
+	if len(config.BaseDomains) == 0 {
+		problems = append(problems, "Base domains: at least one base domain is required")
+	}
+	check("Dashboard domain", validateDomain(config.DashboardDomain))
+	check("Let's Encrypt email", validateEmail(config.LetsEncryptEmail))
+	if config.EnableEmail {
+		check("SMTP host", validateRequired(config.EmailSMTPHost))
+		check("SMTP port", validatePort(config.EmailSMTPPort))
+		check("No-reply email", validateEmail(config.EmailNoReply))
+	}
+	if config.EnableRedis && !config.InstallRedis {
+		check("Redis host", validateRequired(config.RedisHost))
+		check("Redis port", validatePort(config.RedisPort))
+	}
+	if config.DoCrowdsecInstall && config.CrowdsecCaptchaProvider != "" {
+		check("Captcha site key", validateRequired(config.CrowdsecCaptchaSiteKey))
+		check("Captcha secret key", validateRequired(config.CrowdsecCaptchaSecretKey))
+	}
+	return problems
+}
+
+func resetBranding(c *Config) {
+	c.EnableBranding = false
+	c.BrandingAppName, c.BrandingPrimaryColorLight, c.BrandingPrimaryColorDark = "", "", ""
+	c.BrandingLogoLightFile, c.BrandingLogoDarkFile = "", ""
+	c.BrandingLogoLightPath, c.BrandingLogoDarkPath = "", ""
+}
+
+func resetRedis(c *Config) {
+	c.EnableRedis, c.InstallRedis = false, false
+	c.RedisHost, c.RedisPort, c.RedisPassword, c.RedisDB = "", 0, "", 0
+	c.RedisReplicas = nil
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// credential is a secret owned by the installer that can be rotated. rotate
+// updates every file that references the credential and returns the
+// services that must be recreated to pick up the new value.
+type credential struct {
+	name   string
+	rotate func(rc *rotateContext) ([]string, error)
+}
+
+// rotateContext carries what the individual rotations need to know about
+// the install they are working on.
+type rotateContext struct {
+	reader        *bufio.Reader
+	containerType SupportedContainer
+	secretsMode   string
+	smtpPassword  string
+}
+
+var credentials = []credential{
+	{name: "server-secret", rotate: rotateServerSecret},
+	{name: "bouncer-key", rotate: rotateBouncerKey},
+	{name: "smtp-password", rotate: rotateSMTPPassword},
+	{name: "postgres-password", rotate: rotatePostgresPassword},
+	{name: "redis-password", rotate: rotateRedisPassword},
+}
+
+// errNotManaged is returned by a rotation when the credential is not in use
+// or not managed by the installer on this install.
+type errNotManaged struct {
+	reason string
+}
+
+func (e errNotManaged) Error() string {
+	return e.reason
+}
+
+// rotateCredentials rotates the named credentials, or all of them, then
+// recreates only the affected services and waits for them to be healthy.
+func rotateCredentials(args []string) error {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	smtpPassword := fs.String("smtp-password", "", "New SMTP password (prompted for when omitted)")
+	fs.Usage = func() {
+		fmt.Println("Usage: installer rotate [flags] <all|" + credentialNames() + ">...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no credential to rotate")
+	}
+
+	if _, err := os.Stat("config/config.yml"); err != nil {
+		return fmt.Errorf("no Pangolin install found in the current directory")
+	}
+
+	all := fs.NArg() == 1 && fs.Arg(0) == "all"
+	selected, err := selectCredentials(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	rc := &rotateContext{
+		reader:        bufio.NewReader(os.Stdin),
+		containerType: detectContainerType(),
+		secretsMode:   detectSecretsMode(),
+		smtpPassword:  *smtpPassword,
+	}
+
+	if err := backupConfig(); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+
+	var services []string
+	for _, c := range selected {
+		fmt.Printf("\n=== Rotating %s ===\n", c.name)
+		affected, err := c.rotate(rc)
+		if err != nil {
+			// Rotating everything skips the credentials this install does not use
+			if _, ok := err.(errNotManaged); ok && all {
+				fmt.Printf("Skipping %s: %v\n", c.name, err)
+				continue
+			}
+			// Services whose credentials already changed must not keep
+			// running with the old ones
+			if len(services) > 0 {
+				if restartErr := restartRotatedServices(rc, services); restartErr != nil {
+					fmt.Printf("Error: %v\n", restartErr)
+				}
+			}
+			return fmt.Errorf("failed to rotate %s: %v", c.name, err)
+		}
+		for _, service := range affected {
+			if !slices.Contains(services, service) {
+				services = append(services, service)
+			}
+		}
+		fmt.Printf("Rotated %s.\n", c.name)
+	}
+
+	if len(services) == 0 {
+		return nil
+	}
+
+	if err := restartRotatedServices(rc, services); err != nil {
+		return err
+	}
+
+	fmt.Println("\nCredential rotation complete!")
+	return nil
+}
+
+// restartRotatedServices recreates the services whose credentials changed
+// and waits until they are healthy again.
+func restartRotatedServices(rc *rotateContext, services []string) error {
+	fmt.Println("\n=== Restarting affected services ===")
+	if err := recreateContainers(rc.containerType, services...); err != nil {
+		return err
+	}
+	for _, service := range services {
+		if err := waitForHealthy(service, rc.containerType); err != nil {
+			return err
+		}
+		fmt.Printf("%s is healthy.\n", service)
+	}
+	return nil
+}
+
+// selectCredentials resolves the credential names given on the command line.
+func selectCredentials(names []string) ([]credential, error) {
+	if slices.Equal(names, []string{"all"}) {
+		return credentials, nil
+	}
+
+	var selected []credential
+	for _, name := range names {
+		found := false
+		for _, c := range credentials {
+			if c.name == name {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown credential %q, valid options are all, %s", name, strings.ReplaceAll(credentialNames(), "|", ", "))
+		}
+	}
+	return selected, nil
+}
+
+func credentialNames() string {
+	names := make([]string, len(credentials))
+	for i, c := range credentials {
+		names[i] = c.name
+	}
+	return strings.Join(names, "|")
+}
+
+// rotateServerSecret re-encrypts the values Pangolin stores with the server
+// secret using pangctl inside the running container, then stores the new
+// secret wherever the install keeps it.
+func rotateServerSecret(rc *rotateContext) ([]string, error) {
+	oldSecret, err := readServerSecret(rc.secretsMode)
+	if err != nil {
+		return nil, err
+	}
+	if oldSecret == "" {
+		return nil, fmt.Errorf("no server secret found")
+	}
+
+	if !isContainerRunning("pangolin", rc.containerType) {
+		return nil, fmt.Errorf("the pangolin container must be running to re-encrypt the database")
+	}
+
+	newSecret := generateRandomSecretKey()
+
+	// pangctl verifies the old secret against config.yml and rewrites the
+	// file when done. Keep the original so comments and the way the secret is
+	// stored survive, and give pangctl the secret it expects to find.
+	original, err := os.ReadFile("config/config.yml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	if rc.secretsMode != secretsModeInline {
+		if err := injectServerSecret("config/config.yml", original, oldSecret); err != nil {
+			return nil, err
+		}
+	}
+
+	// The secrets reach the container through the environment of the exec
+	// client, so they do not show up in the arguments of the host process
+	cmd := exec.Command(string(rc.containerType), "exec", "-e", "OLD_SERVER_SECRET", "-e", "NEW_SERVER_SECRET", "pangolin",
+		"sh", "-c", `exec pangctl rotate-server-secret --old-secret "$OLD_SERVER_SECRET" --new-secret "$NEW_SERVER_SECRET"`)
+	cmd.Env = append(os.Environ(), "OLD_SERVER_SECRET="+oldSecret, "NEW_SERVER_SECRET="+newSecret)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	rotateErr := cmd.Run()
+
+	if err := os.WriteFile("config/config.yml", original, 0600); err != nil {
+		return nil, fmt.Errorf("error restoring config file: %v", err)
+	}
+	if rotateErr != nil {
+		return nil, fmt.Errorf("pangctl rotate-server-secret failed: %v", rotateErr)
+	}
+
+	switch rc.secretsMode {
+	case secretsModeFiles:
+		err = setEnvFileValue(filepath.Join(secretsDir, "pangolin.env"), "SERVER_SECRET", newSecret)
+	case secretsModeDocker:
+		err = writeSecretFile(filepath.Join(secretsDir, "server_secret"), newSecret)
+	default:
+		_, err = replaceYAMLValue("config/config.yml", "secret", oldSecret, newSecret)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"pangolin"}, nil
+}
+
+// readRedisPassword reads the password Pangolin uses for Redis from where it
+// is stored, or "" when it uses none.
+func readRedisPassword(secretsMode string) (string, error) {
+	switch secretsMode {
+	case secretsModeFiles:
+		values, err := readEnvFile(filepath.Join(secretsDir, "pangolin.env"))
+		if err != nil {
+			return "", err
+		}
+		return values["REDIS_PASSWORD"], nil
+	case secretsModeDocker:
+		password, err := os.ReadFile(filepath.Join(secretsDir, "redis_password"))
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read Redis password: %v", err)
+		}
+		return strings.TrimSpace(string(password)), nil
+	}
+
+	privateConfig, err := ReadPrivateConfig(privateConfigPath)
+	if err != nil {
+		return "", err
+	}
+	return privateConfig.Redis.Password, nil
+}
+
+// readServerSecret reads the current server secret from where it is stored.
+func readServerSecret(secretsMode string) (string, error) {
+	switch secretsMode {
+	case secretsModeFiles:
+		values, err := readEnvFile(filepath.Join(secretsDir, "pangolin.env"))
+		if err != nil {
+			return "", err
+		}
+		return values["SERVER_SECRET"], nil
+	case secretsModeDocker:
+		secret, err := os.ReadFile(filepath.Join(secretsDir, "server_secret"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read server secret: %v", err)
+		}
+		return strings.TrimSpace(string(secret)), nil
+	}
+
+	appConfig, err := ReadAppConfig("config/config.yml")
+	if err != nil {
+		return "", err
+	}
+	return appConfig.Secret, nil
+}
+
+// injectServerSecret writes a copy of config.yml with server.secret set so
+// pangctl can verify the old secret. The caller restores the original.
+func injectServerSecret(path string, content []byte, secret string) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return fmt.Errorf("error parsing config file: %v", err)
+	}
+	if err := setYAMLNodeValue(&root, secret, "server", "secret"); err != nil {
+		return fmt.Errorf("error updating config file: %v", err)
+	}
+
+	data, err := MarshalYAMLWithIndent(&root, 4)
+	if err != nil {
+		return fmt.Errorf("error marshaling config file: %v", err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// rotateBouncerKey deregisters the traefik bouncer, registers it again and
+// writes the new key into the Traefik dynamic configuration.
+func rotateBouncerKey(rc *rotateContext) ([]string, error) {
+	if !checkIsCrowdsecInstalledInCompose() {
+		return nil, errNotManaged{"CrowdSec is not installed"}
+	}
+
+	oldKey, err := ReadBouncerKey("config/traefik/dynamic_config.yml")
+	if err != nil {
+		return nil, err
+	}
+	if oldKey == "" {
+		return nil, fmt.Errorf("no bouncer key found in config/traefik/dynamic_config.yml")
+	}
+
+	newKey, err := RotateCrowdSecAPIKey(rc.containerType)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := replaceYAMLValue("config/traefik/dynamic_config.yml", "crowdsecLapiKey", oldKey, newKey); err != nil {
+		return nil, err
+	}
+	if err := secureFile("config/traefik/dynamic_config.yml"); err != nil {
+		return nil, err
+	}
+
+	return []string{"traefik"}, nil
+}
+
+// rotateSMTPPassword stores a new SMTP password. The password belongs to the
+// mail provider, so it has to be changed there first and is only entered here.
+func rotateSMTPPassword(rc *rotateContext) ([]string, error) {
+	var oldPassword string
+	switch rc.secretsMode {
+	case secretsModeFiles:
+		values, err := readEnvFile(filepath.Join(secretsDir, "pangolin.env"))
+		if err != nil {
+			return nil, err
+		}
+		oldPassword = values["EMAIL_SMTP_PASS"]
+	case secretsModeDocker:
+		if _, err := os.Stat(filepath.Join(secretsDir, "smtp_pass")); err != nil {
+			return nil, errNotManaged{"email is not configured"}
+		}
+	default:
+		appConfig, err := ReadAppConfig("config/config.yml")
+		if err != nil {
+			return nil, err
+		}
+		oldPassword = appConfig.SMTPPass
+	}
+	if oldPassword == "" && rc.secretsMode != secretsModeDocker {
+		return nil, errNotManaged{"email is not configured"}
+	}
+
+	newPassword := rc.smtpPassword
+	if newPassword == "" {
+		fmt.Println("Change the password with your mail provider first, then enter it here.")
+		newPassword = readPassword("Enter the new SMTP password", rc.reader)
+	}
+	if newPassword == "" {
+		return nil, fmt.Errorf("no SMTP password given")
+	}
+
+	var err error
+	switch rc.secretsMode {
+	case secretsModeFiles:
+		err = setEnvFileValue(filepath.Join(secretsDir, "pangolin.env"), "EMAIL_SMTP_PASS", newPassword)
+	case secretsModeDocker:
+		err = writeSecretFile(filepath.Join(secretsDir, "smtp_pass"), newPassword)
+	default:
+		var changed bool
+		changed, err = replaceYAMLValue("config/config.yml", "smtp_pass", oldPassword, newPassword)
+		if err == nil && !changed {
+			err = fmt.Errorf("smtp_pass not found in config/config.yml")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"pangolin"}, nil
+}
+
+// rotatePostgresPassword is a placeholder for installs where the installer
+// deploys Postgres itself. The installer does not do that yet.
+func rotatePostgresPassword(rc *rotateContext) ([]string, error) {
+	return nil, errNotManaged{"Postgres is not managed by the installer"}
+}
+
+// rotateRedisPassword changes the password of the bundled Redis service and
+// the one Pangolin uses to connect to it.
+func rotateRedisPassword(rc *rotateContext) ([]string, error) {
+	privateConfig, err := ReadPrivateConfig(privateConfigPath)
+	if err != nil || privateConfig.Redis.Host != "redis" {
+		return nil, errNotManaged{"Redis is not managed by the installer"}
+	}
+	oldPassword, err := readRedisPassword(rc.secretsMode)
+	if err != nil {
+		return nil, err
+	}
+	if oldPassword == "" {
+		return nil, errNotManaged{"Redis is not managed by the installer"}
+	}
+	newPassword := generateRandomSecretKey()
+
+	switch rc.secretsMode {
+	case secretsModeFiles:
+		err = setEnvFileValue(filepath.Join(secretsDir, "redis.env"), "REDISCLI_AUTH", newPassword)
+		if err == nil {
+			err = setEnvFileValue(filepath.Join(secretsDir, "pangolin.env"), "REDIS_PASSWORD", newPassword)
+		}
+	case secretsModeDocker:
+		err = writeSecretFile(filepath.Join(secretsDir, "redis_password"), newPassword)
+	default:
+		_, err = replaceYAMLValue(privateConfigPath, "password", oldPassword, newPassword)
+		if err == nil {
+			err = setComposeEnvironment("docker-compose.yml", "redis", "REDISCLI_AUTH", newPassword)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Redis does not persist requirepass, recreating it applies the new one
+	return []string{"redis", "pangolin"}, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const (
+	geoipUpdateUnit     = "pangolin-geoip-update"
+	systemdUnitDir      = "/etc/systemd/system"
+	cronFile            = "/etc/cron.d/pangolin-geoip-update"
+	geoipUpdateLogFile  = "/var/log/pangolin-geoip-update.log"
+	geoipUpdateSchedule = "weekly"
+
+	maxmindCredentialsFile = "config/secrets/maxmind.env"
+)
+
+var flagGeoIPAutoUpdate = flag.Bool("geoip-auto-update", false, "Install a weekly systemd timer (or cron job) that updates the GeoLite2 databases")
+
+var geoipServiceTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=Update the Pangolin GeoLite2 databases
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+WorkingDirectory={{.Dir}}
+ExecStart={{.Executable}} update geoip
+`))
+
+var geoipTimerTemplate = template.Must(template.New("timer").Parse(`[Unit]
+Description=Weekly update of the Pangolin GeoLite2 databases
+
+[Timer]
+OnCalendar={{.Schedule}}
+RandomizedDelaySec=6h
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`))
+
+var geoipCronTemplate = template.Must(template.New("cron").Parse(`# Weekly update of the Pangolin GeoLite2 databases, installed by the Pangolin installer
+SHELL=/bin/sh
+PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
+17 4 * * 1 root cd "{{.Dir}}" && "{{.Executable}}" update geoip >> {{.LogFile}} 2>&1
+`))
+
+// scheduleData is rendered into the systemd units and the cron file.
+type scheduleData struct {
+	Dir        string
+	Executable string
+	Schedule   string
+	LogFile    string
+}
+
+// offerGeoIPAutoUpdate asks whether the databases should be kept up to date
+// and installs the schedule when the answer is yes.
+func offerGeoIPAutoUpdate(reader *bufio.Reader, creds MaxMindCredentials) {
+	if isGeoIPAutoUpdateInstalled() {
+		return
+	}
+	if !readBoolFlag(reader, "geoip-auto-update", "Would you like to update the GeoLite2 databases automatically every week?", false) {
+		return
+	}
+
+	if err := installGeoIPAutoUpdate(creds); err != nil {
+		fmt.Printf("Error scheduling GeoLite2 updates: %v\n", err)
+		fmt.Println("You can update the databases manually with: installer update geoip")
+	}
+}
+
+// isGeoIPAutoUpdateInstalled reports whether a timer or cron job exists.
+func isGeoIPAutoUpdateInstalled() bool {
+	if _, err := os.Stat(filepath.Join(systemdUnitDir, geoipUpdateUnit+".timer")); err == nil {
+		return true
+	}
+	if _, err := os.Stat(cronFile); err == nil {
+		return true
+	}
+	return false
+}
+
+// installGeoIPAutoUpdate installs a systemd timer running "installer update
+// geoip" from the install directory, or a cron job on systems without
+// systemd. MaxMind credentials are stored next to the other secrets so the
+// scheduled run can use the official download.
+func installGeoIPAutoUpdate(creds MaxMindCredentials) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("scheduling updates requires root")
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return err
+	}
+
+	if creds.valid() {
+		if err := mkdirAll(secretsDir, 0700); err != nil {
+			return fmt.Errorf("failed to create secrets directory: %v", err)
+		}
+		content := fmt.Sprintf("MAXMIND_ACCOUNT_ID=%s\nMAXMIND_LICENSE_KEY=%s\n", creds.AccountID, creds.LicenseKey)
+		if err := writeSecretFile(maxmindCredentialsFile, content); err != nil {
+			return err
+		}
+	}
+
+	data := scheduleData{
+		Dir:        dir,
+		Executable: executable,
+		Schedule:   geoipUpdateSchedule,
+		LogFile:    geoipUpdateLogFile,
+	}
+
+	if _, err := os.Stat("/run/systemd/system"); err == nil {
+		if err := renderSchedule(filepath.Join(systemdUnitDir, geoipUpdateUnit+".service"), geoipServiceTemplate, data); err != nil {
+			return err
+		}
+		if err := renderSchedule(filepath.Join(systemdUnitDir, geoipUpdateUnit+".timer"), geoipTimerTemplate, data); err != nil {
+			return err
+		}
+		if err := run("systemctl", "daemon-reload"); err != nil {
+			return fmt.Errorf("failed to reload systemd: %v", err)
+		}
+		if err := run("systemctl", "enable", "--now", geoipUpdateUnit+".timer"); err != nil {
+			return fmt.Errorf("failed to enable timer: %v", err)
+		}
+		fmt.Printf("Installed the %s.timer systemd timer.\n", geoipUpdateUnit)
+	} else {
+		if err := renderSchedule(cronFile, geoipCronTemplate, data); err != nil {
+			return err
+		}
+		fmt.Printf("Installed the cron job %s.\n", cronFile)
+	}
+
+	fmt.Printf("The scheduled update runs %s. Keep the installer at %s for it to work.\n", executable, dir)
+	return nil
+}
+
+func renderSchedule(path string, tmpl *template.Template, data scheduleData) error {
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return fmt.Errorf("failed to render %s: %v", path, err)
+	}
+	if err := writeFile(path, rendered.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// updateCommand runs the non-interactive update tasks.
+func updateCommand(args []string) error {
+	if len(args) != 1 || args[0] != "geoip" {
+		return fmt.Errorf("usage: installer update geoip")
+	}
+	return updateGeoIP()
+}
+
+// updateGeoIP refreshes every GeoLite2 database present in config/ and
+// restarts pangolin so it loads the new files. It never prompts, so it can
+// run from the timer.
+func updateGeoIP() error {
+	creds := maxMindCredentialsFromEnv()
+
+	var updated []string
+	for _, db := range geoipDatabases {
+		if _, err := os.Stat(db.path()); err != nil {
+			continue
+		}
+		if err := downloadGeoIPDatabase(db.edition, creds); err != nil {
+			return err
+		}
+		updated = append(updated, db.label)
+	}
+
+	if len(updated) == 0 {
+		return fmt.Errorf("no GeoLite2 databases found in config/")
+	}
+
+	containerType := detectContainerType()
+	if !isContainerRunning("pangolin", containerType) {
+		fmt.Println("Pangolin is not running, the new databases are loaded on the next start.")
+		return nil
+	}
+	if err := restartContainer("pangolin", containerType); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated the GeoLite2 %s databases and restarted Pangolin.\n", strings.Join(updated, " and "))
+	return nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The schema below is a port of configSchema in server/lib/readConfigFile.ts.
+// It checks the types and constraints of every key the server accepts, so
+// an invalid config.yml is caught before the containers are started. Keep
+// it in sync when keys are added to the server schema.
+
+type schemaKind int
+
+const (
+	schemaObject schemaKind = iota
+	schemaRecord
+	schemaList
+	schemaString
+	schemaBool
+	schemaNumber
+	schemaInt
+	schemaPort
+	schemaURL
+	schemaEmail
+	schemaEnum
+)
+
+type schemaNode struct {
+	kind     schemaKind
+	fields   map[string]*schemaNode // schemaObject
+	elem     *schemaNode            // schemaRecord values and schemaList items
+	values   []string               // schemaEnum
+	minLen   int                    // schemaString
+	positive bool                   // schemaNumber
+	min      int                    // schemaInt
+}
+
+func schemaObj(fields map[string]*schemaNode) *schemaNode {
+	return &schemaNode{kind: schemaObject, fields: fields}
+}
+
+func schemaRecordOf(elem *schemaNode) *schemaNode {
+	return &schemaNode{kind: schemaRecord, elem: elem}
+}
+
+func schemaListOf(elem *schemaNode) *schemaNode {
+	return &schemaNode{kind: schemaList, elem: elem}
+}
+
+func schemaStr() *schemaNode      { return &schemaNode{kind: schemaString} }
+func schemaBoolean() *schemaNode  { return &schemaNode{kind: schemaBool} }
+func schemaPositive() *schemaNode { return &schemaNode{kind: schemaNumber, positive: true} }
+func schemaNum() *schemaNode      { return &schemaNode{kind: schemaNumber} }
+func schemaPortNum() *schemaNode  { return &schemaNode{kind: schemaPort} }
+
+var appConfigSchema = schemaObj(map[string]*schemaNode{
+	"app": schemaObj(map[string]*schemaNode{
+		"dashboard_url":       {kind: schemaURL},
+		"log_level":           {kind: schemaEnum, values: []string{"debug", "info", "warn", "error"}},
+		"save_logs":           schemaBoolean(),
+		"log_failed_attempts": schemaBoolean(),
+		"telemetry": schemaObj(map[string]*schemaNode{
+			"anonymous_usage": schemaBoolean(),
+		}),
+		"notifications": schemaObj(map[string]*schemaNode{
+			"product_updates": schemaBoolean(),
+			"new_releases":    schemaBoolean(),
+		}),
+	}),
+	"domains": schemaRecordOf(schemaObj(map[string]*schemaNode{
+		"base_domain":          {kind: schemaString, minLen: 1},
+		"cert_resolver":        schemaStr(),
+		"prefer_wildcard_cert": schemaBoolean(),
+	})),
+	"server": schemaObj(map[string]*schemaNode{
+		"integration_port":               schemaPortNum(),
+		"external_port":                  schemaPortNum(),
+		"internal_port":                  schemaPortNum(),
+		"next_port":                      schemaPortNum(),
+		"internal_hostname":              schemaStr(),
+		"session_cookie_name":            schemaStr(),
+		"resource_access_token_param":    schemaStr(),
+		"resource_session_request_param": schemaStr(),
+		"resource_access_token_headers": schemaObj(map[string]*schemaNode{
+			"id":    schemaStr(),
+			"token": schemaStr(),
+		}),
+		"dashboard_session_length_hours": schemaPositive(),
+		"resource_session_length_hours":  schemaPositive(),
+		"cors": schemaObj(map[string]*schemaNode{
+			"origins":         schemaListOf(schemaStr()),
+			"methods":         schemaListOf(schemaStr()),
+			"allowed_headers": schemaListOf(schemaStr()),
+			"credentials":     schemaBoolean(),
+		}),
+		"trust_proxy":      {kind: schemaInt, min: 0},
+		"secret":           {kind: schemaString, minLen: 8},
+		"maxmind_db_path":  schemaStr(),
+		"maxmind_asn_path": schemaStr(),
+	}),
+	"postgres": schemaObj(map[string]*schemaNode{
+		"connection_string": schemaStr(),
+		"replicas": schemaListOf(schemaObj(map[string]*schemaNode{
+			"connection_string": schemaStr(),
+		})),
+		"pool": schemaObj(map[string]*schemaNode{
+			"max_connections":         schemaPositive(),
+			"max_replica_connections": schemaPositive(),
+			"idle_timeout_ms":         schemaPositive(),
+			"connection_timeout_ms":   schemaPositive(),
+		}),
+	}),
+	"traefik": schemaObj(map[string]*schemaNode{
+		"http_entrypoint":            schemaStr(),
+		"https_entrypoint":           schemaStr(),
+		"additional_middlewares":     schemaListOf(schemaStr()),
+		"cert_resolver":              schemaStr(),
+		"prefer_wildcard_cert":       schemaBoolean(),
+		"certificates_path":          schemaStr(),
+		"monitor_interval":           schemaNum(),
+		"dynamic_cert_config_path":   schemaStr(),
+		"dynamic_router_config_path": schemaStr(),
+		"static_domains":             schemaListOf(schemaStr()),
+		"site_types":                 schemaListOf(schemaStr()),
+		"allow_raw_resources":        schemaBoolean(),
+		"file_mode":                  schemaBoolean(),
+		"pp_transport_prefix":        schemaStr(),
+	}),
+	"gerbil": schemaObj(map[string]*schemaNode{
+		"exit_node_name":     schemaStr(),
+		"start_port":         schemaPortNum(),
+		"clients_start_port": schemaPortNum(),
+		"base_endpoint":      schemaStr(),
+		"use_subdomain":      schemaBoolean(),
+		"subnet_group":       schemaStr(),
+		"block_size":         schemaPositive(),
+		"site_block_size":    schemaPositive(),
+	}),
+	"orgs": schemaObj(map[string]*schemaNode{
+		"block_size":           schemaPositive(),
+		"subnet_group":         schemaStr(),
+		"utility_subnet_group": schemaStr(),
+	}),
+	"rate_limits": schemaObj(map[string]*schemaNode{
+		"global": schemaObj(map[string]*schemaNode{
+			"window_minutes": schemaPositive(),
+			"max_requests":   schemaPositive(),
+		}),
+		"auth": schemaObj(map[string]*schemaNode{
+			"window_minutes": schemaPositive(),
+			"max_requests":   schemaPositive(),
+		}),
+	}),
+	"email": schemaObj(map[string]*schemaNode{
+		"smtp_host":                    schemaStr(),
+		"smtp_port":                    schemaPortNum(),
+		"smtp_user":                    schemaStr(),
+		"smtp_pass":                    schemaStr(),
+		"smtp_secure":                  schemaBoolean(),
+		"smtp_tls_reject_unauthorized": schemaBoolean(),
+		"no_reply":                     {kind: schemaEmail},
+	}),
+	"flags": schemaObj(map[string]*schemaNode{
+		"require_email_verification":     schemaBoolean(),
+		"disable_signup_without_invite":  schemaBoolean(),
+		"disable_user_create_org":        schemaBoolean(),
+		"allow_raw_resources":            schemaBoolean(),
+		"enable_integration_api":         schemaBoolean(),
+		"disable_local_sites":            schemaBoolean(),
+		"disable_basic_wireguard_sites":  schemaBoolean(),
+		"disable_config_managed_domains": schemaBoolean(),
+		"disable_product_help_banners":   schemaBoolean(),
+	}),
+	"dns": schemaObj(map[string]*schemaNode{
+		"nameservers":     schemaListOf(schemaStr()),
+		"cname_extension": schemaStr(),
+	}),
+})
+
+// validateInstallConfig checks the config.yml of the install in the current
+// directory.
+func validateInstallConfig() error {
+	return validateConfigFile("config/config.yml", detectSecretsMode() != secretsModeInline)
+}
+
+// validateConfigFile checks config.yml against appConfigSchema and the
+// refinements of the server schema. secretFromEnv tells whether the server
+// secret is passed in the environment instead of the file.
+func validateConfigFile(path string, secretFromEnv bool) error {
+	content, err := readFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return fmt.Errorf("%s is not valid YAML: %v", path, err)
+	}
+
+	var problems []string
+	validateSchemaValue(appConfigSchema, "", config, &problems)
+
+	lookup := func(keys ...string) (interface{}, bool) {
+		var value interface{} = config
+		for _, key := range keys {
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if value, ok = m[key]; !ok {
+				return nil, false
+			}
+		}
+		return value, true
+	}
+
+	domains, _ := lookup("domains")
+	disableDomains, _ := lookup("flags", "disable_config_managed_domains")
+	if m, _ := domains.(map[string]interface{}); len(m) == 0 && disableDomains != true {
+		problems = append(problems, "domains: at least one domain must be defined")
+	}
+	if _, ok := lookup("server", "secret"); !ok && !secretFromEnv {
+		problems = append(problems, "server.secret: must be defined")
+	}
+	if _, ok := lookup("app", "dashboard_url"); !ok {
+		problems = append(problems, "app.dashboard_url: must be defined")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s is invalid:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func validateSchemaValue(schema *schemaNode, path string, value interface{}, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	switch schema.kind {
+	case schemaObject, schemaRecord:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			fail("must be a mapping")
+			return
+		}
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+			field := schema.elem
+			if schema.kind == schemaObject {
+				if field = schema.fields[key]; field == nil {
+					*problems = append(*problems, fmt.Sprintf("%s: unknown key", keyPath))
+					continue
+				}
+			}
+			validateSchemaValue(field, keyPath, m[key], problems)
+		}
+
+	case schemaList:
+		list, ok := value.([]interface{})
+		if !ok {
+			fail("must be a list")
+			return
+		}
+		for i, item := range list {
+			validateSchemaValue(schema.elem, fmt.Sprintf("%s[%d]", path, i), item, problems)
+		}
+
+	case schemaString:
+		s, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+		} else if len(s) < schema.minLen {
+			fail("must be at least %d characters long", schema.minLen)
+		}
+
+	case schemaBool:
+		if _, ok := value.(bool); !ok {
+			fail("must be true or false")
+		}
+
+	case schemaNumber:
+		n, ok := schemaNumberValue(value)
+		if !ok {
+			fail("must be a number")
+		} else if schema.positive && n <= 0 {
+			fail("must be greater than 0")
+		}
+
+	case schemaInt:
+		n, ok := value.(int)
+		if !ok {
+			fail("must be an integer")
+		} else if n < schema.min {
+			fail("must be at least %d", schema.min)
+		}
+
+	case schemaPort:
+		n, ok := value.(int)
+		if !ok {
+			fail("must be a port number")
+		} else if n < 1 || n > 65535 {
+			fail("port %d is out of range 1-65535", n)
+		}
+
+	case schemaURL:
+		s, _ := value.(string)
+		if u, err := url.Parse(s); err != nil || u.Scheme == "" || u.Host == "" {
+			fail("must be a URL, got %q", s)
+		}
+
+	case schemaEmail:
+		s, _ := value.(string)
+		if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+			fail("must be an email address, got %q", s)
+		}
+
+	case schemaEnum:
+		s, _ := value.(string)
+		if !slices.Contains(schema.values, s) {
+			fail("must be one of %s", strings.Join(schema.values, ", "))
+		}
+	}
+}
+
+func schemaNumberValue(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const validTestAppConfig = `app:
+  dashboard_url: https://pangolin.example.com
+  log_level: info
+domains:
+  domain1:
+    base_domain: example.com
+    cert_resolver: letsencrypt
+server:
+  secret: a-long-enough-secret
+  external_port: 3000
+gerbil:
+  start_port: 51820
+email:
+  smtp_host: smtp.example.com
+  smtp_port: 587
+  no_reply: noreply@example.com
+`
+
+func TestValidateConfigFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		old, new      string
+		secretFromEnv bool
+		want          string // a problem in the error, or "" when the config is accepted
+	}{
+		{name: "accepted"},
+		{
+			name: "unknown key",
+			old:  "  log_level: info\n", new: "  log_level: info\n  log_levle: debug\n",
+			want: "app.log_levle: unknown key",
+		},
+		{
+			name: "port out of range",
+			old:  "start_port: 51820", new: "start_port: 70000",
+			want: "gerbil.start_port: port 70000 is out of range 1-65535",
+		},
+		{
+			name: "short secret",
+			old:  "secret: a-long-enough-secret", new: "secret: short",
+			want: "server.secret: must be at least 8 characters long",
+		},
+		{
+			name: "missing secret",
+			old:  "  secret: a-long-enough-secret\n", new: "",
+			want: "server.secret: must be defined",
+		},
+		{
+			name: "secret in the environment",
+			old:  "  secret: a-long-enough-secret\n", new: "",
+			secretFromEnv: true,
+		},
+		{
+			name: "bad no_reply",
+			old:  "no_reply: noreply@example.com", new: "no_reply: Pangolin <noreply@example.com>",
+			want: `email.no_reply: must be an email address, got "Pangolin <noreply@example.com>"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			os.WriteFile("config.yml", []byte(strings.Replace(validTestAppConfig, tt.old, tt.new, 1)), 0644)
+
+			err := validateConfigFile("config.yml", tt.secretFromEnv)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("no error, want %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSchemaValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema *schemaNode
+		value  interface{}
+		want   string
+	}{
+		{name: "port", schema: schemaPortNum(), value: 443},
+		{name: "port zero", schema: schemaPortNum(), value: 0, want: "x: port 0 is out of range 1-65535"},
+		{name: "port as string", schema: schemaPortNum(), value: "443", want: "x: must be a port number"},
+		{name: "positive", schema: schemaPositive(), value: 0.5},
+		{name: "not positive", schema: schemaPositive(), value: 0, want: "x: must be greater than 0"},
+		{name: "enum", schema: appConfigSchema.fields["app"].fields["log_level"], value: "trace", want: "x: must be one of debug, info, warn, error"},
+		{name: "url without scheme", schema: &schemaNode{kind: schemaURL}, value: "pangolin.example.com", want: `x: must be a URL, got "pangolin.example.com"`},
+		{name: "list item", schema: schemaListOf(schemaStr()), value: []interface{}{"a", 1}, want: "x[1]: must be a string"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var problems []string
+			validateSchemaValue(tt.schema, "x", tt.value, &problems)
+			got := strings.Join(problems, "\n")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
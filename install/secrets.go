@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	secretsModeInline = "inline"
+	secretsModeFiles  = "files"
+	secretsModeDocker = "docker"
+
+	secretsDir = "config/secrets"
+
+	defaultSecretAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	defaultSecretLength   = 32
+	minSecretLength       = 8
+)
+
+var (
+	flagSecrets        = flag.String("secrets", "", "Where secrets are stored: inline in the config files, in separate env files, or as Docker secrets (inline/files/docker)")
+	flagSecretLength   = flag.Int("secret-length", defaultSecretLength, "Length of generated secrets")
+	flagSecretAlphabet = flag.String("secret-alphabet", defaultSecretAlphabet, "Characters used for generated secrets")
+	flagSecretsOwner   = flag.String("secrets-owner", "", "User (and optional :group) owning files that contain secrets; defaults to the user running sudo")
+)
+
+// InlineSecrets reports whether secrets are written directly into the
+// configuration files.
+func (c Config) InlineSecrets() bool {
+	return c.SecretsMode == "" || c.SecretsMode == secretsModeInline
+}
+
+// FileSecrets reports whether secrets are passed to the containers through
+// env files referenced from the compose file.
+func (c Config) FileSecrets() bool {
+	return c.SecretsMode == secretsModeFiles
+}
+
+// DockerSecrets reports whether secrets are passed to the containers as
+// compose secrets mounted under /run/secrets.
+func (c Config) DockerSecrets() bool {
+	return c.SecretsMode == secretsModeDocker
+}
+
+// collectSecretsInput asks how secrets should be stored on disk.
+func collectSecretsInput(reader *bufio.Reader, config *Config) {
+	for {
+		mode := strings.ToLower(readStringFlag(reader, "secrets", "Where should secrets be stored? In the config files, in separate env files or as Docker secrets (inline/files/docker)", secretsModeInline))
+		if mode == secretsModeInline || mode == secretsModeFiles || mode == secretsModeDocker {
+			config.SecretsMode = mode
+			return
+		}
+		fmt.Printf("Unrecognized secrets option: %s. Valid options are 'inline', 'files' or 'docker'.\n", mode)
+		if flagIsSet("secrets") {
+			os.Exit(1)
+		}
+	}
+}
+
+// validateSecretFlags checks the secret generation flags before anything
+// is generated with them.
+func validateSecretFlags() error {
+	if *flagSecretLength < minSecretLength {
+		return fmt.Errorf("secret length must be at least %d", minSecretLength)
+	}
+
+	alphabet := *flagSecretAlphabet
+	if len(alphabet) < 2 {
+		return fmt.Errorf("secret alphabet must contain at least two characters")
+	}
+	for _, r := range alphabet {
+		if r > 127 || r <= ' ' || strings.ContainsRune("\"'`\\$#", r) {
+			return fmt.Errorf("secret alphabet contains %q which cannot be safely written to the config files", r)
+		}
+	}
+
+	return nil
+}
+
+// generateRandomSecretKey generates a secret from crypto/rand using the
+// length and alphabet configured on the command line.
+func generateRandomSecretKey() string {
+	return generateSecret(*flagSecretLength, *flagSecretAlphabet)
+}
+
+// generateSecret returns length characters picked uniformly from alphabet.
+func generateSecret(length int, alphabet string) string {
+	max := big.NewInt(int64(len(alphabet)))
+
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			// crypto/rand only fails if the system has no entropy source
+			panic(fmt.Sprintf("failed to generate secret: %v", err))
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+	return string(b)
+}
+
+// writeSecretFiles writes the secrets that are not inlined in the config
+// files. In files mode they become env files loaded with env_file, in docker
+// mode every secret gets its own file referenced as a compose secret.
+func writeSecretFiles(config Config) error {
+	if config.InlineSecrets() {
+		return nil
+	}
+
+	if err := mkdirAll(secretsDir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %v", err)
+	}
+	if err := chownToSecretsOwner(secretsDir); err != nil {
+		return err
+	}
+
+	if config.FileSecrets() {
+		env := fmt.Sprintf("SERVER_SECRET=%s\n", config.Secret)
+		if config.EnableEmail {
+			env += fmt.Sprintf("EMAIL_SMTP_PASS=%s\n", config.EmailSMTPPass)
+		}
+		if config.RedisPassword != "" {
+			env += fmt.Sprintf("REDIS_PASSWORD=%s\n", config.RedisPassword)
+			for _, name := range config.RedisReplicaPasswordVars() {
+				env += fmt.Sprintf("%s=%s\n", name, config.RedisPassword)
+			}
+		}
+		if err := writeSecretFile(filepath.Join(secretsDir, "pangolin.env"), env); err != nil {
+			return err
+		}
+		if config.InstallRedis {
+			if err := writeSecretFile(filepath.Join(secretsDir, "redis.env"), fmt.Sprintf("REDISCLI_AUTH=%s\n", config.RedisPassword)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := writeSecretFile(filepath.Join(secretsDir, "server_secret"), config.Secret); err != nil {
+		return err
+	}
+	if config.EnableEmail {
+		if err := writeSecretFile(filepath.Join(secretsDir, "smtp_pass"), config.EmailSMTPPass); err != nil {
+			return err
+		}
+	}
+	if config.RedisPassword != "" {
+		if err := writeSecretFile(filepath.Join(secretsDir, "redis_password"), config.RedisPassword); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSecretFile writes content to path readable only by its owner.
+func writeSecretFile(path string, content string) error {
+	if err := writeHiddenFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return secureFile(path)
+}
+
+// secureFile restricts an existing file that holds secrets to mode 0600 and
+// hands it to the secrets owner.
+func secureFile(path string) error {
+	if isDryRun() {
+		return nil
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to restrict permissions of %s: %v", path, err)
+	}
+	return chownToSecretsOwner(path)
+}
+
+// isSensitiveFile reports whether a rendered config file contains secrets.
+func isSensitiveFile(path string, config Config) bool {
+	switch path {
+	case "config/config.yml", privateConfigPath:
+		return true
+	case "config/traefik/dynamic_config.yml", "config/crowdsec/dynamic_config.yml":
+		// The bouncer key and the captcha secret key
+		return config.DoCrowdsecInstall
+	case "config/docker-compose.yml", "docker-compose.yml":
+		return config.InstallRedis && config.InlineSecrets()
+	}
+	return false
+}
+
+// chownToSecretsOwner changes the owner of path to the configured secrets
+// owner. Nothing is changed when the installer runs as a regular user or no
+// owner could be determined.
+func chownToSecretsOwner(path string) error {
+	uid, gid, err := secretsOwner()
+	if err != nil {
+		return err
+	}
+	if uid < 0 || os.Geteuid() != 0 || isDryRun() {
+		return nil
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to change owner of %s: %v", path, err)
+	}
+	return nil
+}
+
+// secretsOwner resolves the --secrets-owner flag, falling back to the user
+// that invoked sudo. It returns -1 when the current user should keep
+// ownership.
+func secretsOwner() (int, int, error) {
+	owner := *flagSecretsOwner
+	if owner == "" {
+		uid, uidErr := strconv.Atoi(os.Getenv("SUDO_UID"))
+		gid, gidErr := strconv.Atoi(os.Getenv("SUDO_GID"))
+		if uidErr != nil || gidErr != nil {
+			return -1, -1, nil
+		}
+		return uid, gid, nil
+	}
+
+	userName, groupName, hasGroup := strings.Cut(owner, ":")
+
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			return -1, -1, fmt.Errorf("unknown secrets owner %q", userName)
+		}
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+
+	if hasGroup {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return -1, -1, fmt.Errorf("unknown secrets group %q", groupName)
+			}
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	return uid, gid, nil
+}
+
+// detectSecretsMode works out how an existing install stores its secrets
+// from the files written by writeSecretFiles.
+func detectSecretsMode() string {
+	if fileExists(filepath.Join(secretsDir, "server_secret")) {
+		return secretsModeDocker
+	}
+	if fileExists(filepath.Join(secretsDir, "pangolin.env")) {
+		return secretsModeFiles
+	}
+	return secretsModeInline
+}
+
+// readEnvFile parses the KEY=VALUE lines of an env file.
+func readEnvFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// setEnvFileValue sets key in an env file, appending it when missing.
+func setEnvFileValue(path string, key string, value string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	found := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), key+"=") {
+			lines[i] = key + "=" + value
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, key+"="+value)
+	}
+
+	return writeSecretFile(path, strings.Join(lines, "\n")+"\n")
+}
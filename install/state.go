@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The install state records how far an installation got, so a run that
+// died half way resumes where it stopped instead of taking the existing
+// config.yml for a finished install.
+
+const installStatePath = "config/installer-state.yml"
+
+const (
+	stepConfig     = "config"
+	stepGeoIP      = "geoip"
+	stepContainers = "containers"
+	stepComplete   = "complete"
+)
+
+var installStepDescriptions = map[string]string{
+	stepConfig:     "writing the configuration files",
+	stepGeoIP:      "downloading the GeoLite2 databases",
+	stepContainers: "starting the containers",
+	stepComplete:   "showing the setup token",
+}
+
+type installState struct {
+	Steps  []string `yaml:"steps"`
+	Config Config   `yaml:"config"`
+	// RedisPasswordSet records that an external Redis needs a password, so a
+	// resumed install asks for it again
+	RedisPasswordSet bool `yaml:"redis_password_set,omitempty"`
+}
+
+// loadInstallState reads the install state, returning nil when there is
+// none: either nothing was installed yet or the install predates the state
+// file and is complete.
+func loadInstallState() (*installState, error) {
+	content, err := readFile(installStatePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", installStatePath, err)
+	}
+
+	state := &installState{}
+	if err := yaml.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", installStatePath, err)
+	}
+	return state, nil
+}
+
+// newInstallState starts the state of a new install.
+func newInstallState(config Config) (*installState, error) {
+	state := &installState{Config: config}
+	return state, state.save()
+}
+
+func (s *installState) done(step string) bool {
+	return slices.Contains(s.Steps, step)
+}
+
+// complete records a finished step.
+func (s *installState) complete(step string) error {
+	if !s.done(step) {
+		s.Steps = append(s.Steps, step)
+	}
+	return s.save()
+}
+
+// next returns the first step that has not finished.
+func (s *installState) next() string {
+	for _, step := range []string{stepConfig, stepGeoIP, stepContainers, stepComplete} {
+		if !s.done(step) {
+			return step
+		}
+	}
+	return ""
+}
+
+// save writes the state without the secrets; they are already in the
+// config files or are generated or asked for again when the files are
+// rewritten.
+func (s *installState) save() error {
+	s.RedisPasswordSet = s.RedisPasswordSet || s.Config.RedisPassword != ""
+	saved := *s
+	saved.Config.Secret = ""
+	saved.Config.EmailSMTPPass = ""
+	saved.Config.RedisPassword = ""
+	saved.Config.TraefikBouncerKey = ""
+	saved.Config.CrowdsecCaptchaSecretKey = ""
+	saved.Config.MaxMind.LicenseKey = ""
+
+	data, err := yaml.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := mkdirAll("config", 0755); err != nil {
+		return err
+	}
+	content := append([]byte("# Progress of the Pangolin installer, used to resume an interrupted install.\n# Contains no secrets.\n"), data...)
+	return writeFile(installStatePath, content, 0600)
+}
+
+// completeInstallStep records a finished step. The install goes on when the
+// state cannot be saved, it just cannot be resumed from there.
+func completeInstallStep(state *installState, step string) {
+	if err := state.complete(step); err != nil {
+		fmt.Printf("Warning: could not save the install state: %v\n", err)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	flagTemplates = flag.String("templates", "", "Directory of templates laid out like the config directory that replace or add to the installer's config files")
+	flagVarsFile  = flag.String("vars-file", "", "YAML file of extra variables for the templates, available as .Vars.<name>")
+	flagVars      = templateVarsFlag{}
+)
+
+func init() {
+	flag.Var(flagVars, "var", "Extra template variable as name=value, available as .Vars.<name> (repeatable, overrides --vars-file)")
+}
+
+// templateVarsFlag collects the repeatable --var flag.
+type templateVarsFlag map[string]string
+
+func (v templateVarsFlag) String() string {
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (v templateVarsFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	v[strings.TrimSpace(name)] = val
+	return nil
+}
+
+// templates holds the templates the installer renders. It is the embedded
+// config files unless --templates layers a directory over them.
+var templates fs.FS = configFiles
+
+// templateDir is the directory layered over the embedded config files, if
+// any.
+var templateDir string
+
+// templateVars holds the extra variables from --vars-file and --var.
+var templateVars map[string]interface{}
+
+// templateOverridesPath records the template directory and the extra
+// variables of an install, so later runs and commands render the same
+// templates without the flags being given again.
+const templateOverridesPath = "config/installer-templates.yml"
+
+type templateOverrides struct {
+	Templates string                 `yaml:"templates,omitempty"`
+	Vars      map[string]interface{} `yaml:"vars,omitempty"`
+}
+
+// loadTemplateOverrides sets up the template directory and the extra
+// variables given on the command line, or those recorded by the install
+// when none are given.
+func loadTemplateOverrides() error {
+	if *flagTemplates == "" && *flagVarsFile == "" && len(flagVars) == 0 {
+		return loadRecordedTemplateOverrides()
+	}
+
+	if *flagTemplates != "" {
+		dir, err := filepath.Abs(*flagTemplates)
+		if err != nil {
+			return fmt.Errorf("template directory: %v", err)
+		}
+		if err := useTemplateDir(dir); err != nil {
+			return err
+		}
+	}
+
+	templateVars = make(map[string]interface{})
+	if *flagVarsFile != "" {
+		content, err := os.ReadFile(*flagVarsFile)
+		if err != nil {
+			return fmt.Errorf("error reading variables file: %v", err)
+		}
+		if err := yaml.Unmarshal(content, &templateVars); err != nil {
+			return fmt.Errorf("error parsing variables file %s: %v", *flagVarsFile, err)
+		}
+	}
+	for name, value := range flagVars {
+		templateVars[name] = value
+	}
+
+	return nil
+}
+
+// loadRecordedTemplateOverrides applies the overrides recorded by
+// saveTemplateOverrides, if any.
+func loadRecordedTemplateOverrides() error {
+	templateVars = make(map[string]interface{})
+
+	content, err := os.ReadFile(templateOverridesPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", templateOverridesPath, err)
+	}
+	var recorded templateOverrides
+	if err := yaml.Unmarshal(content, &recorded); err != nil {
+		return fmt.Errorf("error parsing %s: %v", templateOverridesPath, err)
+	}
+
+	if recorded.Templates != "" {
+		if err := useTemplateDir(recorded.Templates); err != nil {
+			return err
+		}
+	}
+	for name, value := range recorded.Vars {
+		templateVars[name] = value
+	}
+	return nil
+}
+
+// useTemplateDir layers a template directory over the embedded config
+// files.
+func useTemplateDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("template directory: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("template directory %s is not a directory", dir)
+	}
+	templates = overlayFS{base: configFiles, override: os.DirFS(dir)}
+	templateDir = dir
+	fmt.Printf("Using templates from %s over the built-in config files.\n", dir)
+	return nil
+}
+
+// saveTemplateOverrides records the template directory and the extra
+// variables in use. The variables may hold secrets, so the file is secured
+// like the secret files.
+func saveTemplateOverrides() error {
+	if templateDir == "" && len(templateVars) == 0 {
+		return nil
+	}
+
+	data, err := yaml.Marshal(templateOverrides{Templates: templateDir, Vars: templateVars})
+	if err != nil {
+		return err
+	}
+	content := append([]byte("# Templates and variables the installer renders this install with.\n"), data...)
+	if err := writeFile(templateOverridesPath, content, 0600); err != nil {
+		return err
+	}
+	return secureFile(templateOverridesPath)
+}
+
+// overlayFS serves the files of override in place of the same paths below
+// the config directory of base. Files only in override are added.
+type overlayFS struct {
+	base     fs.FS
+	override fs.FS
+}
+
+// overridePath maps a path of base to the override directory.
+func (o overlayFS) overridePath(name string) (string, bool) {
+	if name == "config" {
+		return ".", true
+	}
+	return strings.CutPrefix(name, "config/")
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if path, ok := o.overridePath(name); ok {
+		if file, err := o.override.Open(path); err == nil {
+			return file, nil
+		}
+	}
+	return o.base.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, baseErr := fs.ReadDir(o.base, name)
+
+	path, ok := o.overridePath(name)
+	if !ok {
+		return entries, baseErr
+	}
+	overrides, err := fs.ReadDir(o.override, path)
+	if err != nil {
+		return entries, baseErr
+	}
+
+	merged := make(map[string]fs.DirEntry)
+	for _, entry := range entries {
+		merged[entry.Name()] = entry
+	}
+	for _, entry := range overrides {
+		// Skip hidden files such as .git of a checked out template repository
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		merged[entry.Name()] = entry
+	}
+
+	result := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
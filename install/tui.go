@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var flagTUI = flag.Bool("tui", true, "Use the full-screen wizard and progress view when running in a terminal (-tui=false for plain prompts)")
+
+// useTUI reports whether the full-screen interface can be used. It needs a
+// terminal on both stdin and stdout; piped or scripted input falls back to
+// the plain prompts.
+func useTUI() bool {
+	return *flagTUI && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+type keyKind int
+
+const (
+	keyRune keyKind = iota
+	keyEnter
+	keyBackspace
+	keyTab
+	keyBackTab
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyEscape
+	keyInterrupt
+	keyUnknown
+)
+
+type key struct {
+	kind keyKind
+	r    rune
+}
+
+// terminal is the terminal in raw mode on the alternate screen, so the
+// scrollback is left as it was once the wizard closes.
+type terminal struct {
+	reader *bufio.Reader
+	state  *term.State
+}
+
+func openTerminal(reader *bufio.Reader) (*terminal, error) {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, fmt.Errorf("error setting up the terminal: %v", err)
+	}
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	return &terminal{reader: reader, state: state}, nil
+}
+
+func (t *terminal) close() {
+	fmt.Print("\x1b[?25h\x1b[?1049l")
+	term.Restore(int(os.Stdin.Fd()), t.state)
+}
+
+// size returns the width and height of the terminal, with a fallback for
+// terminals that do not report it.
+func (t *terminal) size() (int, int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// draw replaces the screen with lines, cut to the size of the terminal.
+func (t *terminal) draw(lines []string) {
+	width, height := t.size()
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(truncateLine(line, width))
+	}
+	fmt.Print(b.String())
+}
+
+// readKey reads one key press. Escape sequences arrive in a single read, so
+// an escape with nothing buffered behind it is the Esc key itself.
+func (t *terminal) readKey() (key, error) {
+	r, _, err := t.reader.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return key{kind: keyEnter}, nil
+	case 0x7f, 0x08:
+		return key{kind: keyBackspace}, nil
+	case '\t':
+		return key{kind: keyTab}, nil
+	case 0x03:
+		return key{kind: keyInterrupt}, nil
+	case 0x1b:
+		if t.reader.Buffered() == 0 {
+			return key{kind: keyEscape}, nil
+		}
+		next, _, _ := t.reader.ReadRune()
+		if next != '[' && next != 'O' {
+			return key{kind: keyUnknown}, nil
+		}
+		code, _, _ := t.reader.ReadRune()
+		switch code {
+		case 'A':
+			return key{kind: keyUp}, nil
+		case 'B':
+			return key{kind: keyDown}, nil
+		case 'C':
+			return key{kind: keyRight}, nil
+		case 'D':
+			return key{kind: keyLeft}, nil
+		case 'Z':
+			return key{kind: keyBackTab}, nil
+		}
+		// Skip the rest of longer sequences such as Delete (ESC [ 3 ~)
+		for code >= '0' && code <= '9' || code == ';' {
+			code, _, _ = t.reader.ReadRune()
+		}
+		return key{kind: keyUnknown}, nil
+	}
+
+	if r < ' ' {
+		return key{kind: keyUnknown}, nil
+	}
+	return key{kind: keyRune, r: r}, nil
+}
+
+// truncateLine cuts a line to width visible characters, skipping over the
+// ANSI color sequences used for highlighting.
+func truncateLine(line string, width int) string {
+	var b strings.Builder
+	visible := 0
+	inEscape := false
+	for _, r := range line {
+		switch {
+		case inEscape:
+			b.WriteRune(r)
+			if r >= '@' && r <= '~' && r != '[' {
+				inEscape = false
+			}
+		case r == 0x1b:
+			inEscape = true
+			b.WriteRune(r)
+		case visible < width:
+			b.WriteRune(r)
+			visible++
+		}
+	}
+	if strings.Contains(line, "\x1b[") {
+		b.WriteString("\x1b[0m")
+	}
+	return b.String()
+}
+
+const (
+	styleBold  = "\x1b[1m"
+	styleDim   = "\x1b[2m"
+	styleRed   = "\x1b[31m"
+	styleGreen = "\x1b[32m"
+	styleCyan  = "\x1b[36m"
+	styleReset = "\x1b[0m"
+)
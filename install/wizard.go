@@ -0,0 +1,971 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The wizard asks the same questions as collectUserInput on a full screen,
+// one step at a time. Every field writes straight into the Config, so the
+// review step and the rest of the installer see the same values as with the
+// plain prompts.
+
+var errWizardAborted = errors.New("installation cancelled")
+
+type wizardFieldKind int
+
+const (
+	fieldText wizardFieldKind = iota
+	fieldPassword
+	fieldToggle
+	fieldChoice
+)
+
+// wizardField is an input of a wizard step. set applies a text or choice
+// value to the config and returns an error, without applying it, when the
+// value is invalid.
+type wizardField struct {
+	label   string
+	help    string
+	kind    wizardFieldKind
+	options []string
+	get     func(c *Config) string
+	set     func(c *Config, value string) error
+	getBool func(c *Config) bool
+	setBool func(c *Config, value bool)
+	visible func(c *Config) bool
+}
+
+type wizardStep struct {
+	title   string
+	intro   []string
+	fields  []*wizardField
+	visible func(c *Config) bool
+	review  bool
+}
+
+type wizard struct {
+	config  *Config
+	steps   []*wizardStep
+	step    int
+	focus   int
+	text    map[*wizardField]string
+	errs    map[*wizardField]error
+	checked map[*wizardStep]bool
+	message string
+}
+
+// runWizard collects the configuration with the full-screen wizard.
+func runWizard(reader *bufio.Reader) (Config, error) {
+	config := defaultWizardConfig()
+	w := newWizard(&config)
+
+	t, err := openTerminal(reader)
+	if err != nil {
+		return config, err
+	}
+	err = w.run(t)
+	t.close()
+	if err != nil {
+		return config, err
+	}
+
+	// Flags may have seeded Enterprise settings for a Community install
+	if !config.IsEnterprise {
+		resetBranding(&config)
+		resetRedis(&config)
+	}
+	if config.BrandingLogoDarkFile == "" {
+		config.BrandingLogoDarkFile = config.BrandingLogoLightFile
+		config.BrandingLogoDarkPath = config.BrandingLogoLightPath
+	}
+
+	if config.EnableEmail && *flagSMTPTest {
+		fmt.Printf("Testing the connection to %s:%d...\n", config.EmailSMTPHost, config.EmailSMTPPort)
+		if err := testSMTPConnection(config); err != nil {
+			fmt.Printf("SMTP test failed: %v\n", err)
+			fmt.Println("Keeping the SMTP settings as entered. Email delivery may not work.")
+		} else {
+			fmt.Println("SMTP connection and authentication succeeded!")
+		}
+	}
+
+	return config, nil
+}
+
+// defaultWizardConfig returns the defaults of the plain prompts, with the
+// answers given as flags filled in.
+func defaultWizardConfig() Config {
+	config := Config{
+		Vars:                           templateVars,
+		InstallGerbil:                  true,
+		EnableIPv6:                     true,
+		EnableGeoblocking:              true,
+		EnableASN:                      *flagGeoIPASN,
+		MaxMind:                        maxMindCredentialsFromEnv(),
+		SecretsMode:                    secretsModeInline,
+		BaseDomains:                    collectFlagBaseDomains(),
+		EnableEmail:                    *flagEmail,
+		EmailSMTPHost:                  *flagSMTPHost,
+		EmailSMTPPort:                  *flagSMTPPort,
+		EmailSMTPSecure:                *flagSMTPSecure,
+		EmailSMTPUser:                  *flagSMTPUser,
+		EmailSMTPPass:                  *flagSMTPPassword,
+		EmailNoReply:                   *flagSMTPNoReply,
+		EmailSMTPTLSRejectUnauthorized: *flagSMTPTLSRejectUnauthorized,
+		EnableBranding:                 *flagBranding,
+		BrandingAppName:                *flagBrandingAppName,
+		BrandingPrimaryColorLight:      *flagBrandingPrimaryColor,
+		BrandingPrimaryColorDark:       *flagBrandingPrimaryColorDark,
+	}
+	config.CrowdsecTrustedProxies, _ = parseCIDRList(*flagCrowdsecTrustedProxies, true)
+	config.CrowdsecTrustedClients, _ = parseCIDRList(*flagCrowdsecTrustedClients, false)
+	if provider := strings.ToLower(*flagCrowdsecCaptcha); slices.Contains(captchaProviders, provider) {
+		config.CrowdsecCaptchaProvider = provider
+		config.CrowdsecCaptchaSiteKey = *flagCrowdsecCaptchaSiteKey
+		config.CrowdsecCaptchaSecretKey = *flagCrowdsecCaptchaSecretKey
+	}
+	if flagIsSet("secrets") {
+		config.SecretsMode = strings.ToLower(*flagSecrets)
+	}
+	if len(config.BaseDomains) > 0 {
+		config.DashboardDomain = "pangolin." + config.BaseDomains[0].Domain
+	}
+	if config.EnableBranding && config.BrandingAppName == "" {
+		config.BrandingAppName = "Pangolin"
+	}
+	setLogoFile(&config, false, *flagBrandingLogoLight)
+	setLogoFile(&config, true, *flagBrandingLogoDark)
+	setRedisMode(&config, strings.ToLower(*flagRedis))
+	if config.EnableRedis && !config.InstallRedis {
+		config.RedisHost = *flagRedisHost
+		config.RedisPort = *flagRedisPort
+		config.RedisPassword = *flagRedisPassword
+		config.RedisDB = *flagRedisDB
+		config.RedisReplicas, _ = parseRedisReplicas(*flagRedisReplicas)
+	}
+	return config
+}
+
+func newWizard(config *Config) *wizard {
+	isEnterprise := func(c *Config) bool { return c.IsEnterprise }
+	hasCaptcha := func(c *Config) bool { return c.CrowdsecCaptchaProvider != "" }
+	provider := "generic"
+	if flagIsSet("smtp-provider") {
+		provider = strings.ToLower(*flagSMTPProvider)
+	}
+
+	steps := []*wizardStep{
+		{
+			title: "Edition",
+			intro: []string{
+				"The Enterprise Edition is free for personal use or for businesses making less than 100k USD annually.",
+				"It is licensed under the Fossorial Commercial License. License keys are activated from the dashboard after installation.",
+			},
+			fields: []*wizardField{
+				{
+					label:   "Install the Enterprise Edition",
+					kind:    fieldToggle,
+					getBool: isEnterprise,
+					setBool: func(c *Config, v bool) {
+						c.IsEnterprise = v
+						if !v {
+							resetBranding(c)
+							resetRedis(c)
+						}
+					},
+				},
+			},
+		},
+		{
+			title: "Domains",
+			intro: []string{"Point the A records of the dashboard domain and the domains of your resources to this server."},
+			fields: []*wizardField{
+				{
+					label: "Base domains",
+					help:  "Separate domains with spaces. Set certificates per domain with example.com,cert_resolver=name,prefer_wildcard_cert=true",
+					kind:  fieldText,
+					get: func(c *Config) string {
+						domains := make([]string, 0, len(c.BaseDomains))
+						for _, d := range c.BaseDomains {
+							domains = append(domains, d.String())
+						}
+						return strings.Join(domains, " ")
+					},
+					set: func(c *Config, value string) error {
+						domains, err := parseBaseDomainList(value)
+						if err != nil {
+							return err
+						}
+						// Keep the suggested dashboard domain in step with the first base domain
+						if c.DashboardDomain == "" || len(c.BaseDomains) > 0 && c.DashboardDomain == "pangolin."+c.BaseDomains[0].Domain {
+							c.DashboardDomain = "pangolin." + domains[0].Domain
+						}
+						c.BaseDomains = domains
+						return nil
+					},
+				},
+				{
+					label: "Dashboard domain",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.DashboardDomain },
+					set: func(c *Config, value string) error {
+						if err := validateDomain(value); err != nil {
+							return err
+						}
+						c.DashboardDomain = strings.ToLower(value)
+						return nil
+					},
+				},
+				{
+					label: "Let's Encrypt email",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.LetsEncryptEmail },
+					set: func(c *Config, value string) error {
+						if err := validateEmail(value); err != nil {
+							return err
+						}
+						c.LetsEncryptEmail = value
+						return nil
+					},
+				},
+			},
+		},
+		{
+			// There is no Postgres toggle: the installer only deploys the
+			// SQLite images and has no Postgres service to add.
+			title: "Components",
+			fields: []*wizardField{
+				{
+					label:   "Gerbil tunnels",
+					help:    "Gerbil accepts the WireGuard tunnels of sites and clients. Without it only resources this server can reach are exposed.",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.InstallGerbil },
+					setBool: func(c *Config, v bool) { c.InstallGerbil = v },
+				},
+				{
+					label:   "CrowdSec",
+					help:    "A minimal CrowdSec deployment. It adds complexity and you are expected to manage and tune it yourself.",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.DoCrowdsecInstall },
+					setBool: func(c *Config, v bool) { c.DoCrowdsecInstall = v },
+				},
+				{
+					label:   "GeoLite2 country database",
+					help:    "Needed for geoblocking rules.",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.EnableGeoblocking },
+					setBool: func(c *Config, v bool) {
+						c.EnableGeoblocking = v
+						if !v {
+							c.EnableASN = false
+						}
+					},
+				},
+				{
+					label:   "GeoLite2 ASN database",
+					help:    "Needed for rules based on the network operator, e.g. blocking hosting providers.",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.EnableASN },
+					setBool: func(c *Config, v bool) { c.EnableASN = v },
+					visible: func(c *Config) bool { return c.EnableGeoblocking },
+				},
+				{
+					label:   "Email (SMTP)",
+					help:    "Lets Pangolin send invitations, password resets and verification codes.",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.EnableEmail },
+					setBool: func(c *Config, v bool) { c.EnableEmail = v },
+				},
+				{
+					label:   "IPv6",
+					help:    "Enable if this server has IPv6 connectivity.",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.EnableIPv6 },
+					setBool: func(c *Config, v bool) { c.EnableIPv6 = v },
+				},
+				{
+					label:   "Custom branding",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.EnableBranding },
+					setBool: func(c *Config, v bool) {
+						resetBranding(c)
+						if v {
+							c.EnableBranding = true
+							c.BrandingAppName = "Pangolin"
+						}
+					},
+					visible: isEnterprise,
+				},
+				{
+					label:   "Redis",
+					help:    "Redis is required to run more than one Pangolin replica. Bundled runs it next to Pangolin.",
+					kind:    fieldChoice,
+					options: []string{redisModeNone, redisModeBundled, redisModeExternal},
+					get:     redisMode,
+					set: func(c *Config, value string) error {
+						setRedisMode(c, value)
+						return nil
+					},
+					visible: isEnterprise,
+				},
+			},
+		},
+		{
+			title:   "Email",
+			visible: func(c *Config) bool { return c.EnableEmail },
+			fields: []*wizardField{
+				{
+					label:   "Provider",
+					kind:    fieldChoice,
+					options: smtpProviderNames(),
+					get:     func(c *Config) string { return provider },
+					set: func(c *Config, value string) error {
+						provider = value
+						for _, p := range smtpProviders {
+							if p.name == value && p.port != 0 {
+								c.EmailSMTPHost = p.host
+								if p.name == "ses" {
+									c.EmailSMTPHost = fmt.Sprintf(p.host, "us-east-1")
+								}
+								c.EmailSMTPPort = p.port
+								c.EmailSMTPSecure = p.secure
+							}
+						}
+						return nil
+					},
+				},
+				{
+					label: "SMTP host",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.EmailSMTPHost },
+					set: func(c *Config, value string) error {
+						if err := validateRequired(value); err != nil {
+							return err
+						}
+						c.EmailSMTPHost = value
+						return nil
+					},
+				},
+				{
+					label: "SMTP port",
+					kind:  fieldText,
+					get:   func(c *Config) string { return strconv.Itoa(c.EmailSMTPPort) },
+					set:   setPortField(func(c *Config) *int { return &c.EmailSMTPPort }),
+				},
+				{
+					label:   "Implicit TLS",
+					help:    "Port 465 expects TLS from the first byte, other ports upgrade with STARTTLS.",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.EmailSMTPSecure },
+					setBool: func(c *Config, v bool) { c.EmailSMTPSecure = v },
+				},
+				{
+					label: "SMTP username",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.EmailSMTPUser },
+					set: func(c *Config, value string) error {
+						c.EmailSMTPUser = value
+						return nil
+					},
+				},
+				{
+					label: "SMTP password",
+					kind:  fieldPassword,
+					get:   func(c *Config) string { return c.EmailSMTPPass },
+					set: func(c *Config, value string) error {
+						c.EmailSMTPPass = value
+						return nil
+					},
+				},
+				{
+					label: "No-reply address",
+					help:  "Often the same as the SMTP username.",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.EmailNoReply },
+					set: func(c *Config, value string) error {
+						if err := validateEmail(value); err != nil {
+							return err
+						}
+						c.EmailNoReply = value
+						return nil
+					},
+				},
+				{
+					label:   "Reject invalid TLS certificates",
+					kind:    fieldToggle,
+					getBool: func(c *Config) bool { return c.EmailSMTPTLSRejectUnauthorized },
+					setBool: func(c *Config, v bool) { c.EmailSMTPTLSRejectUnauthorized = v },
+				},
+			},
+		},
+		{
+			title:   "GeoLite2",
+			intro:   []string{"Without a MaxMind account the databases are downloaded from a public mirror."},
+			visible: func(c *Config) bool { return c.EnableGeoblocking },
+			fields: []*wizardField{
+				{
+					label: "MaxMind account ID",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.MaxMind.AccountID },
+					set: func(c *Config, value string) error {
+						c.MaxMind.AccountID = value
+						return nil
+					},
+				},
+				{
+					label: "MaxMind license key",
+					kind:  fieldPassword,
+					get:   func(c *Config) string { return c.MaxMind.LicenseKey },
+					set: func(c *Config, value string) error {
+						if value == "" && c.MaxMind.AccountID != "" {
+							return fmt.Errorf("required with an account ID")
+						}
+						c.MaxMind.LicenseKey = value
+						return nil
+					},
+				},
+			},
+		},
+		{
+			title: "Enterprise",
+			visible: func(c *Config) bool {
+				return c.IsEnterprise && (c.EnableBranding || c.EnableRedis && !c.InstallRedis)
+			},
+			fields: []*wizardField{
+				{
+					label: "Application name",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.BrandingAppName },
+					set: func(c *Config, value string) error {
+						if err := validateRequired(value); err != nil {
+							return err
+						}
+						c.BrandingAppName = value
+						return nil
+					},
+					visible: func(c *Config) bool { return c.EnableBranding },
+				},
+				{
+					label: "Primary color (light theme)",
+					help:  "Any CSS color. Leave empty for the default.",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.BrandingPrimaryColorLight },
+					set: func(c *Config, value string) error {
+						c.BrandingPrimaryColorLight = value
+						return nil
+					},
+					visible: func(c *Config) bool { return c.EnableBranding },
+				},
+				{
+					label: "Primary color (dark theme)",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.BrandingPrimaryColorDark },
+					set: func(c *Config, value string) error {
+						c.BrandingPrimaryColorDark = value
+						return nil
+					},
+					visible: func(c *Config) bool { return c.EnableBranding },
+				},
+				{
+					label: "Logo file (light theme)",
+					help:  "Path to the logo on this server. Leave empty for the default.",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.BrandingLogoLightFile },
+					set: func(c *Config, value string) error {
+						return setLogoFile(c, false, value)
+					},
+					visible: func(c *Config) bool { return c.EnableBranding },
+				},
+				{
+					label: "Logo file (dark theme)",
+					help:  "Leave empty to use the light logo.",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.BrandingLogoDarkFile },
+					set: func(c *Config, value string) error {
+						return setLogoFile(c, true, value)
+					},
+					visible: func(c *Config) bool { return c.EnableBranding },
+				},
+				{
+					label: "Redis host",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.RedisHost },
+					set: func(c *Config, value string) error {
+						if err := validateRequired(value); err != nil {
+							return err
+						}
+						c.RedisHost = value
+						return nil
+					},
+					visible: isExternalRedis,
+				},
+				{
+					label:   "Redis port",
+					kind:    fieldText,
+					get:     func(c *Config) string { return strconv.Itoa(c.RedisPort) },
+					set:     setPortField(func(c *Config) *int { return &c.RedisPort }),
+					visible: isExternalRedis,
+				},
+				{
+					label: "Redis password",
+					help:  "Leave empty if the server does not require one.",
+					kind:  fieldPassword,
+					get:   func(c *Config) string { return c.RedisPassword },
+					set: func(c *Config, value string) error {
+						c.RedisPassword = value
+						return nil
+					},
+					visible: isExternalRedis,
+				},
+				{
+					label: "Redis database",
+					kind:  fieldText,
+					get:   func(c *Config) string { return strconv.Itoa(c.RedisDB) },
+					set: func(c *Config, value string) error {
+						db, err := strconv.Atoi(value)
+						if err != nil || db < 0 {
+							return fmt.Errorf("must be a number of 0 or more")
+						}
+						c.RedisDB = db
+						return nil
+					},
+					visible: isExternalRedis,
+				},
+				{
+					label: "Redis read replicas",
+					help:  "Comma separated host:port list. Leave empty for none.",
+					kind:  fieldText,
+					get: func(c *Config) string {
+						replicas := make([]string, 0, len(c.RedisReplicas))
+						for _, r := range c.RedisReplicas {
+							replicas = append(replicas, fmt.Sprintf("%s:%d", r.Host, r.Port))
+						}
+						return strings.Join(replicas, ",")
+					},
+					set: func(c *Config, value string) error {
+						replicas, err := parseRedisReplicas(value)
+						if err != nil {
+							return err
+						}
+						c.RedisReplicas = replicas
+						return nil
+					},
+					visible: isExternalRedis,
+				},
+			},
+		},
+		{
+			title: "CrowdSec",
+			intro: []string{
+				"Requests from the container network and the Gerbil tunnels are always trusted.",
+				"Name any proxies in front of Pangolin, so CrowdSec sees the real client address.",
+			},
+			visible: func(c *Config) bool { return c.DoCrowdsecInstall },
+			fields: []*wizardField{
+				{
+					label: "Trusted proxies",
+					help:  "Comma separated CIDRs, or cloudflare. Leave empty for none.",
+					kind:  fieldText,
+					get:   func(c *Config) string { return strings.Join(c.CrowdsecTrustedProxies, ",") },
+					set: func(c *Config, value string) error {
+						proxies, err := parseCIDRList(value, true)
+						if err != nil {
+							return err
+						}
+						c.CrowdsecTrustedProxies = proxies
+						return nil
+					},
+				},
+				{
+					label: "Trusted clients",
+					help:  "Comma separated CIDRs that are never blocked, e.g. your office. Leave empty for none.",
+					kind:  fieldText,
+					get:   func(c *Config) string { return strings.Join(c.CrowdsecTrustedClients, ",") },
+					set: func(c *Config, value string) error {
+						clients, err := parseCIDRList(value, false)
+						if err != nil {
+							return err
+						}
+						c.CrowdsecTrustedClients = clients
+						return nil
+					},
+				},
+				{
+					label:   "Captcha provider",
+					help:    "Serves CrowdSec's captcha decisions. With none those requests are banned instead.",
+					kind:    fieldChoice,
+					options: append([]string{captchaNone}, captchaProviders...),
+					get: func(c *Config) string {
+						if c.CrowdsecCaptchaProvider == "" {
+							return captchaNone
+						}
+						return c.CrowdsecCaptchaProvider
+					},
+					set: func(c *Config, value string) error {
+						if value == captchaNone {
+							value = ""
+						}
+						c.CrowdsecCaptchaProvider = value
+						return nil
+					},
+				},
+				{
+					label: "Captcha site key",
+					kind:  fieldText,
+					get:   func(c *Config) string { return c.CrowdsecCaptchaSiteKey },
+					set: func(c *Config, value string) error {
+						if err := validateRequired(value); err != nil {
+							return err
+						}
+						c.CrowdsecCaptchaSiteKey = value
+						return nil
+					},
+					visible: hasCaptcha,
+				},
+				{
+					label: "Captcha secret key",
+					kind:  fieldPassword,
+					get:   func(c *Config) string { return c.CrowdsecCaptchaSecretKey },
+					set: func(c *Config, value string) error {
+						if err := validateRequired(value); err != nil {
+							return err
+						}
+						c.CrowdsecCaptchaSecretKey = value
+						return nil
+					},
+					visible: hasCaptcha,
+				},
+			},
+		},
+		{
+			title: "Secrets",
+			intro: []string{
+				"inline: in the config files",
+				"files:  in separate env files only readable by the owner",
+				"docker: as Docker secrets mounted into the containers",
+			},
+			fields: []*wizardField{
+				{
+					label:   "Store secrets",
+					kind:    fieldChoice,
+					options: []string{secretsModeInline, secretsModeFiles, secretsModeDocker},
+					get:     func(c *Config) string { return c.SecretsMode },
+					set: func(c *Config, value string) error {
+						c.SecretsMode = value
+						return nil
+					},
+				},
+			},
+		},
+		{
+			title:  "Review",
+			intro:  []string{"Press Enter to write the configuration, or Esc to go back and change an answer."},
+			review: true,
+		},
+	}
+
+	w := &wizard{
+		config:  config,
+		steps:   steps,
+		text:    make(map[*wizardField]string),
+		errs:    make(map[*wizardField]error),
+		checked: make(map[*wizardStep]bool),
+	}
+	w.sync(nil)
+	return w
+}
+
+func isExternalRedis(c *Config) bool {
+	return c.EnableRedis && !c.InstallRedis
+}
+
+// redisMode returns the Redis choice of the config.
+func redisMode(c *Config) string {
+	switch {
+	case c.InstallRedis:
+		return redisModeBundled
+	case c.EnableRedis:
+		return redisModeExternal
+	}
+	return redisModeNone
+}
+
+// setRedisMode switches the Redis choice the way collectRedisInput does.
+func setRedisMode(c *Config, mode string) {
+	resetRedis(c)
+	switch mode {
+	case redisModeBundled:
+		c.EnableRedis = true
+		c.InstallRedis = true
+		c.RedisHost = "redis"
+		c.RedisPort = 6379
+		c.RedisPassword = generateRandomSecretKey()
+	case redisModeExternal:
+		c.EnableRedis = true
+		c.RedisPort = 6379
+	}
+}
+
+// setLogoFile sets a branding logo and the path it is served from.
+func setLogoFile(c *Config, dark bool, path string) error {
+	if path != "" {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			return fmt.Errorf("logo file %s does not exist", path)
+		}
+	}
+
+	webPath := ""
+	if path != "" {
+		name := "/logo-light"
+		if dark {
+			name = "/logo-dark"
+		}
+		webPath = brandingWebPath + name + filepath.Ext(path)
+	}
+	if dark {
+		c.BrandingLogoDarkFile, c.BrandingLogoDarkPath = path, webPath
+	} else {
+		c.BrandingLogoLightFile, c.BrandingLogoLightPath = path, webPath
+	}
+	return nil
+}
+
+func setPortField(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		if err := validatePort(port); err != nil {
+			return err
+		}
+		*field(c) = port
+		return nil
+	}
+}
+
+func smtpProviderNames() []string {
+	names := make([]string, 0, len(smtpProviders))
+	for _, p := range smtpProviders {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+func (w *wizard) visibleSteps() []*wizardStep {
+	var steps []*wizardStep
+	for _, s := range w.steps {
+		if s.visible == nil || s.visible(w.config) {
+			steps = append(steps, s)
+		}
+	}
+	return steps
+}
+
+func (w *wizard) visibleFields(s *wizardStep) []*wizardField {
+	var fields []*wizardField
+	for _, f := range s.fields {
+		if f.visible == nil || f.visible(w.config) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// sync refreshes the text of the fields from the config after an edit, so
+// values derived from other answers show up. Fields holding an invalid
+// value and the field being edited keep what was typed.
+func (w *wizard) sync(editing *wizardField) {
+	for _, s := range w.steps {
+		for _, f := range s.fields {
+			if f == editing || f.kind == fieldToggle || w.errs[f] != nil {
+				continue
+			}
+			w.text[f] = f.get(w.config)
+		}
+	}
+}
+
+func (w *wizard) edit(f *wizardField, value string) {
+	w.text[f] = value
+	w.errs[f] = f.set(w.config, value)
+	w.sync(f)
+}
+
+// checkStep applies every visible field of the current step and moves the
+// focus to the first invalid one.
+func (w *wizard) checkStep(s *wizardStep) bool {
+	for i, f := range w.visibleFields(s) {
+		if f.kind == fieldToggle {
+			continue
+		}
+		if w.errs[f] = f.set(w.config, w.text[f]); w.errs[f] != nil {
+			w.checked[s] = true
+			w.focus = i
+			w.message = fmt.Sprintf("%s: %v", f.label, w.errs[f])
+			return false
+		}
+	}
+	if s.review {
+		if problems := validateUserInput(*w.config); len(problems) > 0 {
+			w.message = problems[0]
+			return false
+		}
+	}
+	return true
+}
+
+func (w *wizard) run(t *terminal) error {
+	for {
+		steps := w.visibleSteps()
+		current := slices.Index(steps, w.steps[w.step])
+		s := steps[current]
+		fields := w.visibleFields(s)
+		w.focus = max(0, min(w.focus, len(fields)-1))
+
+		t.draw(w.render(s, current, len(steps)))
+
+		k, err := t.readKey()
+		if err != nil {
+			return err
+		}
+		w.message = ""
+
+		var f *wizardField
+		if len(fields) > 0 {
+			f = fields[w.focus]
+		}
+
+		switch k.kind {
+		case keyInterrupt:
+			return errWizardAborted
+		case keyUp, keyBackTab:
+			w.focus--
+		case keyDown, keyTab:
+			w.focus++
+		case keyEscape:
+			if current > 0 {
+				w.step = slices.Index(w.steps, steps[current-1])
+				w.focus = 0
+			}
+		case keyEnter:
+			if !w.checkStep(s) {
+				continue
+			}
+			if current == len(steps)-1 {
+				return nil
+			}
+			// The answers of this step may have shown or hidden later steps
+			steps = w.visibleSteps()
+			w.step = slices.Index(w.steps, steps[slices.Index(steps, s)+1])
+			w.focus = 0
+		case keyLeft, keyRight:
+			if f == nil {
+				continue
+			}
+			switch f.kind {
+			case fieldToggle:
+				f.setBool(w.config, !f.getBool(w.config))
+				w.sync(nil)
+			case fieldChoice:
+				i := slices.Index(f.options, f.get(w.config))
+				if k.kind == keyLeft {
+					i = (i - 1 + len(f.options)) % len(f.options)
+				} else {
+					i = (i + 1) % len(f.options)
+				}
+				w.edit(f, f.options[i])
+			}
+		case keyBackspace:
+			if f != nil && (f.kind == fieldText || f.kind == fieldPassword) {
+				if runes := []rune(w.text[f]); len(runes) > 0 {
+					w.edit(f, string(runes[:len(runes)-1]))
+				}
+			}
+		case keyRune:
+			if f == nil {
+				continue
+			}
+			switch f.kind {
+			case fieldText, fieldPassword:
+				w.edit(f, w.text[f]+string(k.r))
+			case fieldToggle:
+				if k.r == ' ' {
+					f.setBool(w.config, !f.getBool(w.config))
+					w.sync(nil)
+				}
+			}
+		}
+	}
+}
+
+func (w *wizard) render(s *wizardStep, current, total int) []string {
+	lines := []string{
+		fmt.Sprintf("%sPangolin installer%s  %sStep %d of %d%s", styleBold, styleReset, styleDim, current+1, total, styleReset),
+		"",
+		styleBold + s.title + styleReset,
+	}
+	for _, line := range s.intro {
+		lines = append(lines, styleDim+line+styleReset)
+	}
+	lines = append(lines, "")
+
+	if s.review {
+		for _, item := range reviewItems {
+			if item.visible == nil || item.visible(*w.config) {
+				lines = append(lines, fmt.Sprintf("  %-22s %s", item.label, item.value(*w.config)))
+			}
+		}
+	}
+
+	fields := w.visibleFields(s)
+	for i, f := range fields {
+		focused := i == w.focus
+		cursor := "  "
+		if focused {
+			cursor = styleCyan + "> " + styleReset
+		}
+
+		var value string
+		switch f.kind {
+		case fieldText:
+			value = w.text[f]
+		case fieldPassword:
+			value = strings.Repeat("*", len([]rune(w.text[f])))
+		case fieldToggle:
+			value = "[ ] no"
+			if f.getBool(w.config) {
+				value = "[x] yes"
+			}
+		case fieldChoice:
+			value = "< " + f.get(w.config) + " >"
+		}
+		if focused && (f.kind == fieldText || f.kind == fieldPassword) {
+			value += "_"
+		}
+
+		line := fmt.Sprintf("%s%-32s %s", cursor, f.label, value)
+		if err := w.errs[f]; err != nil && (w.text[f] != "" || w.checked[s]) {
+			line += fmt.Sprintf("  %s%v%s", styleRed, err, styleReset)
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "")
+	if len(fields) > 0 && fields[w.focus].help != "" {
+		lines = append(lines, styleDim+fields[w.focus].help+styleReset)
+	}
+	if w.message != "" {
+		lines = append(lines, styleRed+w.message+styleReset)
+	}
+
+	lines = append(lines, "", styleDim+"Up/Down select  Left/Right/Space change  Enter next  Esc back  Ctrl-C quit"+styleReset)
+	return lines
+}
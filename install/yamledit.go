@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The helpers in this file edit YAML files as yaml.Node trees instead of
+// decoding them into maps, so comments, key order, anchors and quoting of
+// the user's files survive every change the installer makes.
+
+// readYAMLFile parses a YAML file into a document node. The original content
+// is returned as well so encodeYAML can keep the file's layout.
+func readYAMLFile(path string) (*yaml.Node, []byte, error) {
+	content, err := readFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		// Empty file
+		doc = yaml.Node{Kind: yaml.DocumentNode}
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.MappingNode})
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s is not a YAML mapping", path)
+	}
+
+	return &doc, content, nil
+}
+
+// encodeYAML marshals a document with the indentation of the original file
+// and puts back the blank lines the encoder drops.
+func encodeYAML(doc *yaml.Node, original []byte) ([]byte, error) {
+	untagMergeKeys(doc)
+	data, err := MarshalYAMLWithIndent(doc, detectYAMLIndent(original))
+	if err != nil {
+		return nil, err
+	}
+	return restoreBlankLines(original, data), nil
+}
+
+// untagMergeKeys clears the !!merge tag the decoder puts on "<<" keys, which
+// the encoder would otherwise write out verbatim.
+func untagMergeKeys(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content)-1; i += 2 {
+			if key := node.Content[i]; key.Tag == "!!merge" {
+				key.Tag = ""
+			}
+		}
+	}
+	for _, child := range node.Content {
+		untagMergeKeys(child)
+	}
+}
+
+// writeYAMLFile encodes a document edited from original and writes it back,
+// keeping the file's permissions and owner.
+func writeYAMLFile(path string, doc *yaml.Node, original []byte) error {
+	data, err := encodeYAML(doc, original)
+	if err != nil {
+		return fmt.Errorf("error marshaling %s: %w", path, err)
+	}
+	return writeFileInPlace(path, data)
+}
+
+// writeFileInPlace atomically replaces an existing file, keeping its mode and
+// owner.
+func writeFileInPlace(path string, data []byte) error {
+	if isDryRun() {
+		if !fileExists(path) {
+			return fmt.Errorf("error writing %s: file does not exist", path)
+		}
+		return writeFile(path, data, 0644)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceFileAtomically(path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && os.Geteuid() == 0 {
+		return os.Chown(path, int(stat.Uid), int(stat.Gid))
+	}
+	return nil
+}
+
+// detectYAMLIndent returns the indentation of the first nested mapping key,
+// defaulting to two spaces.
+func detectYAMLIndent(content []byte) int {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if indent == 0 || trimmed == "" || trimmed[0] == '#' || trimmed[0] == '-' {
+			continue
+		}
+		if indent >= 2 && indent <= 8 {
+			return indent
+		}
+	}
+	return 2
+}
+
+// restoreBlankLines puts the blank lines of the original file back in front
+// of the mapping keys (and their head comments) that had one. Keys are
+// matched by their path, so the spacing follows a key even when the edit
+// moved it. New keys get a blank line when their siblings have one.
+func restoreBlankLines(original, edited []byte) []byte {
+	known := make(map[string]bool)
+	spaced := make(map[string]bool)
+	spacedParents := make(map[string]bool)
+	lines := strings.Split(string(original), "\n")
+	for i, path := range yamlKeyPaths(lines) {
+		if path == "" {
+			continue
+		}
+		known[path] = true
+		if start := yamlBlockStart(lines, i); start > 0 && strings.TrimSpace(lines[start-1]) == "" {
+			spaced[path] = true
+			spacedParents[yamlParentPath(path)] = true
+		}
+	}
+
+	lines = strings.Split(string(edited), "\n")
+	blank := make(map[int]bool)
+	for i, path := range yamlKeyPaths(lines) {
+		// Keys added by the edit follow the spacing of their siblings
+		if path == "" || !spaced[path] && (known[path] || !spacedParents[yamlParentPath(path)]) {
+			continue
+		}
+		if start := yamlBlockStart(lines, i); start > 0 && strings.TrimSpace(lines[start-1]) != "" {
+			blank[start] = true
+		}
+	}
+
+	var result []string
+	for i, line := range lines {
+		if blank[i] {
+			result = append(result, "")
+		}
+		result = append(result, line)
+	}
+	return []byte(strings.Join(result, "\n"))
+}
+
+// yamlKeyPaths returns the dotted key path of every line that starts a
+// mapping key, and an empty string for all other lines.
+func yamlKeyPaths(lines []string) []string {
+	type level struct {
+		indent int
+		key    string
+	}
+
+	paths := make([]string, len(lines))
+	var stack []level
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '-' {
+			continue
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 {
+			continue
+		}
+
+		indent := len(line) - len(trimmed)
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, level{indent, strings.Trim(trimmed[:colon], `"'`)})
+
+		keys := make([]string, len(stack))
+		for j, l := range stack {
+			keys[j] = l.key
+		}
+		paths[i] = strings.Join(keys, ".")
+	}
+	return paths
+}
+
+func yamlParentPath(path string) string {
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// yamlBlockStart walks up from a key line over the comment lines directly
+// above it.
+func yamlBlockStart(lines []string, i int) int {
+	for i > 0 && strings.HasPrefix(strings.TrimSpace(lines[i-1]), "#") {
+		i--
+	}
+	return i
+}
+
+// yamlMappingValue returns the value of key in a mapping node, or nil.
+func yamlMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(mapping.Content)-1; i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setYAMLMappingValue replaces the value of key in a mapping node, keeping
+// the comments of the value it replaces, or appends the key when missing.
+func setYAMLMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i < len(mapping.Content)-1; i += 2 {
+		if mapping.Content[i].Value == key {
+			replaceYAMLNode(mapping.Content[i+1], value)
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
+
+// deleteYAMLMappingKey removes key and its value from a mapping node. It
+// reports whether the key was present.
+func deleteYAMLMappingKey(mapping *yaml.Node, key string) bool {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i < len(mapping.Content)-1; i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// yamlChildValue returns the value of key in a mapping node, or nil. An alias
+// is replaced by a copy of its target so edits do not leak into the anchored
+// node.
+func yamlChildValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i < len(mapping.Content)-1; i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		if alias := mapping.Content[i+1]; alias.Kind == yaml.AliasNode {
+			child := copyYAMLNode(alias.Alias)
+			child.Anchor = ""
+			mapping.Content[i+1] = child
+		}
+		return mapping.Content[i+1]
+	}
+	return nil
+}
+
+// yamlChildMapping returns the mapping stored under key, creating it when the
+// key is missing or empty.
+func yamlChildMapping(mapping *yaml.Node, key string) (*yaml.Node, error) {
+	child := yamlChildValue(mapping, key)
+	if child == nil {
+		child = &yaml.Node{Kind: yaml.MappingNode}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+		return child, nil
+	}
+
+	if child.Kind == yaml.ScalarNode && child.Tag == "!!null" {
+		*child = yaml.Node{Kind: yaml.MappingNode, HeadComment: child.HeadComment, LineComment: child.LineComment, FootComment: child.FootComment}
+	}
+	if child.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s is not a mapping", key)
+	}
+	return child, nil
+}
+
+// replaceYAMLNode overwrites dst with src in place. The anchor of dst is kept
+// so aliases pointing at it stay valid, and so are its comments unless src
+// brings its own.
+func replaceYAMLNode(dst, src *yaml.Node) {
+	anchor := dst.Anchor
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+
+	*dst = *src
+	if anchor != "" {
+		dst.Anchor = anchor
+	}
+	if dst.HeadComment == "" {
+		dst.HeadComment = head
+	}
+	if dst.LineComment == "" {
+		dst.LineComment = line
+	}
+	if dst.FootComment == "" {
+		dst.FootComment = foot
+	}
+}
+
+// copyYAMLNode deep copies a node so it can be inserted into another tree.
+func copyYAMLNode(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	c := *node
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c.Content[i] = copyYAMLNode(child)
+	}
+	return &c
+}
+
+// setYAMLNodeValue sets the scalar at keys below a document node, creating
+// missing mappings and keeping the existing node (and its comments) when the
+// key is already present.
+func setYAMLNodeValue(root *yaml.Node, value string, keys ...string) error {
+	if root.Kind != yaml.DocumentNode {
+		return fmt.Errorf("not a YAML document")
+	}
+	if len(root.Content) == 0 {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.MappingNode})
+	}
+
+	node := root.Content[0]
+	for i, key := range keys[:len(keys)-1] {
+		child, err := yamlChildMapping(node, key)
+		if err != nil {
+			return fmt.Errorf("%s is not a mapping", strings.Join(keys[:i+1], "."))
+		}
+		node = child
+	}
+
+	last := keys[len(keys)-1]
+	if existing := yamlMappingValue(node, last); existing != nil && existing.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%s is not a scalar", strings.Join(keys, "."))
+	}
+	setYAMLMappingValue(node, last, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: yaml.DoubleQuotedStyle})
+	return nil
+}
+
+// yamlScalar returns a plain string node.
+func yamlScalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
@@ -17,6 +17,7 @@ import { privateConfigFilePath1 } from "@server/lib/consts";
 import { z } from "zod";
 import { colorsSchema } from "@server/lib/colorsSchema";
 import { build } from "@server/build";
+import { getEnvOrYaml } from "@server/lib/readConfigFile";
 
 const portSchema = z.number().positive().gt(0).lte(65535);
 
@@ -49,7 +50,10 @@ export const privateConfigSchema = z.object({
         .object({
             host: z.string(),
             port: portSchema,
-            password: z.string().optional(),
+            password: z
+                .string()
+                .optional()
+                .transform(getEnvOrYaml("REDIS_PASSWORD")),
             db: z.int().nonnegative().optional().default(0),
             replicas: z
                 .array(
@@ -61,6 +65,16 @@ export const privateConfigSchema = z.object({
                     })
                 )
                 .optional()
+                // REDIS_REPLICA_<n>_PASSWORD overrides the password of the
+                // n-th replica, counting from 1
+                .transform((replicas) =>
+                    replicas?.map((replica, i) => ({
+                        ...replica,
+                        password: getEnvOrYaml(
+                            `REDIS_REPLICA_${i + 1}_PASSWORD`
+                        )(replica.password)
+                    }))
+                )
             // tls: z
             //     .object({
             //         reject_unauthorized: z